@@ -2,25 +2,35 @@ package main
 
 import (
 	"bytes"
+	"container/list"
 	"context"
-	"encoding/hex"
+	"encoding/csv"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"math"
 	"math/big"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+	"unicode"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/fatih/color"
 )
 
@@ -29,6 +39,16 @@ var bootstrapFlag = flag.Bool("bootstrap", false, "set this to fetch metadata us
 var generateBootstrapFlag = flag.Bool("gen_bootstrap", false, "set this to generate bootstrap.data using the current ram file")
 var ramFlag = flag.String("ram", "ram.data", "file name for ram")
 var bootstrapFileFlag = flag.String("in", "bootstrap.data", "file name for bootstrap")
+var discoverFlag = flag.Bool("discover", false, "set this to add the pairs of each chain's factory to the ram file")
+var discoverFromFlag = flag.Uint64("discover_from", 0, "the index in allPairs of the first pair added by -discover")
+var discoverCountFlag = flag.Uint64("discover_count", 1000, "the most pairs of each factory added by -discover, 0 for all of them")
+var listFlag = flag.Bool("list", false, "set this to list the pairs in the ram file (matching the -q queries) with their token addresses")
+var watchFactoriesFlag = flag.Bool("watch_factories", false, "set this to add pairs created by each chain's factory to the ram file while listening")
+var outputFlag = flag.String("output", "text", "output format: text for coloured rows, jsonl for one JSON object per event on stdout")
+var tzFlag = flag.String("tz", "Local", "time zone of the printed times, e.g. America/New_York or UTC")
+var blockTimeFlag = flag.Bool("block_time", false, "set this to stamp the printed events with the time of their block and show how late they were received")
+var csvFlag = flag.String("csv", "", "directory to also write every event to, as one CSV file per day")
+var csvSizeFlag = flag.Int64("csv_size", 0, "start a new CSV file once the current one reaches this many megabytes (0 for one file per day)")
 
 // queryArray... an array of queries given by -q flags
 type queryArray []string
@@ -46,17 +66,32 @@ var queryFlag queryArray
 
 // the main method. this is what is run when the program is executed.
 func main() {
-	flag.Var(&queryFlag, "q", "queries SYMBOL0:SYMBOL1")
+	flag.Var(&queryFlag, "q", "queries SYMBOL0:SYMBOL1 (symbol prefixes or token addresses)")
 	flag.Parse()
+	out, err := new_output(*outputFlag, *tzFlag, *blockTimeFlag, *csvFlag, *csvSizeFlag<<20)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 	var contract abi.ABI
 	contract, _ = abi.JSON(strings.NewReader(lp_abi))
+	// the event ABIs of each pool type, see Pair.Type
+	contracts := make(map[string]abi.ABI)
+	contracts["v2"] = contract
+	contracts["v3"], _ = abi.JSON(strings.NewReader(v3_abi))
+	contracts["curve"], _ = abi.JSON(strings.NewReader(curve_abi()))
+	contracts["balancer"], _ = abi.JSON(strings.NewReader(vault_abi))
 	var ram map[common.Address]Pair
-	var header map[int64]interface{}
+	var header map[int64]*ChainConfig
 	if *bootstrapFlag {
 		fmt.Printf("Load addresses in %s and fetch data? [press enter]", *bootstrapFileFlag)
 		fmt.Scanln()
 		fmt.Print("Fetching data from blockchain...\n")
-		if tmph, tmp, err := load_bootstrap_file(*bootstrapFileFlag); err == nil {
+		registry, err := load_token_file(token_file(*ramFlag))
+		if err != nil {
+			panic(err)
+		}
+		if tmph, tmp, err := load_bootstrap_file(*bootstrapFileFlag, registry); err == nil {
 			ram = tmp
 			header = tmph
 		} else {
@@ -65,7 +100,7 @@ func main() {
 		fmt.Printf("Success! Overwrite %s with fetched data? [press enter]", *ramFlag)
 		fmt.Scanln()
 		fmt.Printf("Overwriting %s...\n", *ramFlag)
-		if err := save_ram_to_ram_file(header, ram, *ramFlag); err == nil {
+		if err := save_ram_to_ram_file(header, ram, registry, *ramFlag); err == nil {
 			fmt.Println("Successs!")
 			os.Exit(0)
 		} else {
@@ -83,41 +118,47 @@ func main() {
 				fmt.Printf("Successfully generated %s\n", *bootstrapFileFlag)
 				os.Exit(0)
 			}
+			if *listFlag {
+				list_pairs(header, ram)
+				os.Exit(0)
+			}
+			if *discoverFlag {
+				fmt.Print("Fetching pairs from the factories...\n")
+				registry := registry_of(ram)
+				n := discover_pairs(header, ram, registry, *discoverFromFlag, *discoverCountFlag)
+				fmt.Printf("Found %d new pairs. Overwrite %s? [press enter]", n, *ramFlag)
+				fmt.Scanln()
+				fmt.Printf("Overwriting %s...\n", *ramFlag)
+				if err := save_ram_to_ram_file(header, ram, registry, *ramFlag); err == nil {
+					fmt.Println("Successs!")
+					os.Exit(0)
+				} else {
+					panic(err)
+				}
+			}
 		} else {
-			fmt.Printf("Make sure %s is in the current directory\n", *ramFlag)
-			fmt.Printf("Run with -bootstrap flag and %s\n", *bootstrapFileFlag)
+			if os.IsNotExist(err) {
+				fmt.Printf("Make sure %s is in the current directory\n", *ramFlag)
+				fmt.Printf("Run with -bootstrap flag and %s\n", *bootstrapFileFlag)
+			}
 			panic(err)
 		}
 	}
 	var d int
 	addresses := make(map[int64][]common.Address)
+	// balancer pools are listened to through the vault of their chain, by pool id
+	vault_pools := make(map[int64][]common.Hash)
 	for key, val := range ram {
 		// filtering by query
-		s0 := strings.ToLower(val.S0)
-		s1 := strings.ToLower(val.S1)
-		var b bool
-		for _, q := range queryFlag {
-			ss := strings.Split(q, ":")
-			switch len(ss) {
-			case 1:
-				a := strings.ToLower(ss[0])
-				b = b || strings.HasPrefix(s0, a) || strings.HasPrefix(s1, a)
-			case 2:
-				a0 := strings.ToLower(ss[0])
-				a1 := strings.ToLower(ss[1])
-				bt0 := strings.HasPrefix(s0, a0) && strings.HasPrefix(s1, a1)
-				bt1 := strings.HasPrefix(s1, a0) && strings.HasPrefix(s0, a1)
-				b = b || bt0 || bt1
-			}
-		}
-		if !b && len(queryFlag) > 0 {
+		if !val.matches(queryFlag) {
 			continue
 		} else {
-			if d < len(s0) {
-				d = len(s0)
+			if w := val.width(); d < w {
+				d = w
 			}
-			if d < len(s1) {
-				d = len(s1)
+			if val.Type == "balancer" {
+				vault_pools[val.Chain] = append(vault_pools[val.Chain], common.HexToHash(val.PoolID))
+				continue
 			}
 			a := addresses[val.Chain]
 			a = append(a, key)
@@ -128,395 +169,3344 @@ func main() {
 	id_swap := topics["Swap"].ID
 	id_mint := topics["Mint"].ID
 	id_burn := topics["Burn"].ID
+	id_sync := topics["Sync"].ID
+	v3_topics := contracts["v3"].Events
+	id_v3_swap := v3_topics["Swap"].ID
+	id_v3_mint := v3_topics["Mint"].ID
+	id_v3_burn := v3_topics["Burn"].ID
+	id_v3_collect := v3_topics["Collect"].ID
+	ids := []common.Hash{id_swap, id_mint, id_burn, id_sync, id_v3_swap, id_v3_mint, id_v3_burn, id_v3_collect}
+	for _, e := range contracts["curve"].Events {
+		ids = append(ids, e.ID)
+	}
+	id_vault_swap := contracts["balancer"].Events["Swap"].ID
 	logs := make(chan types.Log)
-	errs := make(chan error)
+	chains := make(map[int64]*chain_endpoints)
+	for key := range addresses {
+		chains[key] = new_chain_endpoints(key, header[key])
+	}
+	for key := range vault_pools {
+		if _, ok := chains[key]; ok == false {
+			chains[key] = new_chain_endpoints(key, header[key])
+		}
+	}
+	if *watchFactoriesFlag {
+		for key, val := range header {
+			if val.Factory != "" && chains[key] == nil {
+				chains[key] = new_chain_endpoints(key, val)
+			}
+		}
+	}
+	discovered := make(chan discovered_pair)
+	if err := check_all(chains); err != nil {
+		fmt.Fprintf(os.Stderr, "refusing to start, the endpoints of some chains serve another chain:%v\n", err)
+		os.Exit(1)
+	}
+	// start every pair off with its current reserves (or price), so the first swap already has a pre-trade price
+	load_pool_state(ram, addresses, chains)
+	// the recent block headers of every chain, which events are annotated with
+	headers := make(map[int64]*header_cache)
+	for key, eps := range chains {
+		headers[key] = new_header_cache(eps)
+	}
+	// the tokens of the listened pairs, so the pairs found by -watch_factories don't fetch them again
+	registry := registry_of(ram)
+	// the pair query of every chain, extended with the new pairs found by -watch_factories
+	lp_queries := make(map[int64]*live_query)
+	depths := make(map[int64]uint64)
 	var wg sync.WaitGroup
-	for key, val := range addresses {
-		head := header[key].(map[string]interface{})
-		query := ethereum.FilterQuery{
-			Addresses: val,
-			Topics:    [][]common.Hash{{id_swap, id_mint, id_burn}},
+	for key, eps := range chains {
+		go eps.monitor()
+		head := header[key]
+		var queries []*live_query
+		if val := addresses[key]; len(val) > 0 {
+			lp_queries[key] = new_live_query(ethereum.FilterQuery{
+				Addresses: val,
+				Topics:    [][]common.Hash{ids},
+			})
+			queries = append(queries, lp_queries[key])
 		}
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			if wss, ok := head["wss"].(string); wss != "" && ok == true {
-				this_chain_logs := make(chan types.Log)
-				fmt.Printf("dialing %s blockchain...\n", head["name"].(string))
-				client, err := ethclient.Dial(wss)
-				if err != nil {
-					log.Fatal(err)
-				}
-				if tmp, err := client.SubscribeFilterLogs(context.Background(), query, this_chain_logs); err == nil {
-					go func() {
-						for {
-							select {
-							case err := <-tmp.Err():
-								errs <- err
-							case log := <-this_chain_logs:
-								logs <- log
-							}
-						}
-					}()
-				}
+		if val := vault_pools[key]; len(val) > 0 {
+			if head.Vault != "" {
+				// every pool swaps through the vault, so the pools are picked by their poolId topic
+				queries = append(queries, new_live_query(ethereum.FilterQuery{
+					Addresses: []common.Address{common.HexToAddress(head.Vault)},
+					Topics:    [][]common.Hash{{id_vault_swap}, val},
+				}))
+			} else {
+				fmt.Fprintf(os.Stderr, "no vault set for %s blockchain, skipping its balancer pools\n", head.Name)
 			}
-		}()
+		}
+		depth := head.Confirmations
+		if depth > 0 {
+			fmt.Fprintf(os.Stderr, "holding %s events for %d confirmations\n", head.Name, depth)
+		}
+		depths[key] = depth
+		for _, query := range queries {
+			wg.Add(1)
+			go listen(eps, head, query, headers[key], new_confirmer(depth, logs), wg.Done)
+		}
+		if head.Factory != "" && *watchFactoriesFlag {
+			wg.Add(1)
+			go watch_factory(key, head, eps, registry.chain(key), head.Factory, depth, discovered, wg.Done)
+		}
 	}
 	wg.Wait()
-	fmt.Println("successfully initialized! listening for swap events...")
+	fmt.Fprintln(os.Stderr, "successfully initialized! listening for swap events...")
+	j := new_journal()
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	for {
 		select {
-		case err := <-errs:
-			log.Fatal(err)
+		case <-stop:
+			out.close()
+			fmt.Fprintln(os.Stderr, "stopped")
+			return
 		case vLog := <-logs:
-			vLog_handler(ram, contract, vLog, d)
+			vLog_handler(ram, contracts, j, out, headers, vLog, d)
+		case found := <-discovered:
+			if _, ok := ram[found.addr]; ok == true {
+				continue
+			}
+			ram[found.addr] = found.pair
+			fmt.Fprintf(os.Stderr, "new pair %s:%s @ %s, saving it to %s\n", found.pair.S0, found.pair.S1, found.addr.String(), *ramFlag)
+			if err := save_ram_to_ram_file(header, ram, registry, *ramFlag); err != nil {
+				fmt.Fprintf(os.Stderr, "could not save %s (%v)\n", *ramFlag, err)
+			}
+			if !found.pair.matches(queryFlag) {
+				continue
+			}
+			if w := found.pair.width(); d < w {
+				d = w
+			}
+			key := found.pair.Chain
+			if lq, ok := lp_queries[key]; ok == true {
+				lq.add(found.addr)
+			} else {
+				// no pair of this chain was listened to yet, so it gets its own listener
+				lp_queries[key] = new_live_query(ethereum.FilterQuery{
+					Addresses: []common.Address{found.addr},
+					Topics:    [][]common.Hash{ids},
+				})
+				go listen(chains[key], header[key], lp_queries[key], headers[key], new_confirmer(depths[key], logs), func() {})
+			}
+			color.New(color.FgHiCyan).Fprintf(os.Stderr, "new pool %s:%s @ %s on %s blockchain (%s:%s), listening to it\n", found.pair.S0, found.pair.S1, found.addr.String(), chains[key].name, found.pair.T0, found.pair.T1)
 		}
 	}
 }
 
-func vLog_handler(ram map[common.Address]Pair, contract abi.ABI, vLog types.Log, d int) {
-	e, err := contract.EventByID(vLog.Topics[0])
-	if err != nil {
-		panic(err)
-	}
-	p := ram[vLog.Address]
-	var c *color.Color
-	var s string
-	switch e.Name {
-	case "Swap":
-		if f, err := contract.Unpack("Swap", vLog.Data); err == nil {
-			p.swapUpdate(f)
-			s, c = p.String(d)
+// a pair created by a factory while listening, with its metadata already fetched
+type discovered_pair struct {
+	addr common.Address
+	pair Pair
+}
+
+// watches the factory of a chain for PairCreated events and sends every new pair (with its metadata) to found.
+// init is called once the subscription has been set up.
+func watch_factory(chain int64, head *ChainConfig, eps *chain_endpoints, tokens *chain_tokens, factory string, depth uint64, found chan discovered_pair, init func()) {
+	tmpabi, _ := abi.JSON(strings.NewReader(factory_abi))
+	created := make(chan types.Log)
+	query := new_live_query(ethereum.FilterQuery{
+		Addresses: []common.Address{common.HexToAddress(factory)},
+		Topics:    [][]common.Hash{{tmpabi.Events["PairCreated"].ID}},
+	})
+	go listen(eps, head, query, nil, new_confirmer(depth, created), init)
+	for vLog := range created {
+		if vLog.Removed {
+			continue
 		}
-	case "Mint":
-		if f, err := contract.Unpack("Mint", vLog.Data); err == nil {
-			p.mintUpdate(f)
-			s, c = p.String(d)
+		f, err := tmpabi.Unpack("PairCreated", vLog.Data)
+		if err != nil {
+			continue
 		}
-	case "Burn":
-		if f, err := contract.Unpack("Burn", vLog.Data); err == nil {
-			p.burnUpdate(f)
-			s, c = p.String(d)
+		addr, p, err := fetch_pair(f[0].(common.Address).String(), chain, head, tokens, eps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping new pair %s (%v)\n", f[0].(common.Address).String(), err)
+			continue
 		}
+		found <- discovered_pair{addr, p}
 	}
-	loc, _ := time.LoadLocation("America/New_York")
-	now := time.Now().In(loc)
-	c.Printf("%s | %s @ %s | %s\n", s, now.Format("15:04:05"), vLog.Address.String()[:6], fmt.Sprintf("%#x", vLog.TxHash)[:6])
-}
-
-// amt0 should be the "stable" half of the pair (depending on the context...)
-// amt0 amt1 will constantly be updated
-// B is the "normal" parameter which can be changed (change this in the ram file) to flip the "direction" of a pair.
-type Pair struct {
-	S0    string `json:"symbol0"`
-	S1    string `json:"symbol1"`
-	D0    byte   `json:"decimals0"`
-	D1    byte   `json:"decimals1"`
-	amt0  *big.Int
-	amt1  *big.Int
-	Chain int64 `json:"chainID"`
-	B     bool  `json:"normal"`
-	// one byte for the mode: 0 buy 1 sell 2 make 3 break
-	mode byte
 }
 
-// uses the raw *big.Int data and generates *big.Float data, appropriately renormalized using the "decimal" data
-func (p *Pair) amts() (amt0f *big.Float, amt1f *big.Float, price *big.Float) {
-	exp0 := (&big.Float{}).SetInt((&big.Int{}).Exp(big.NewInt(10), big.NewInt(int64(p.D0)), nil))
-	exp1 := (&big.Float{}).SetInt((&big.Int{}).Exp(big.NewInt(10), big.NewInt(int64(p.D1)), nil))
-	price = big.NewFloat(0)
-	amt0f = (&big.Float{}).SetInt(p.amt0)
-	amt1f = (&big.Float{}).SetInt(p.amt1)
-	amt0f.Quo(amt0f, exp0)
-	amt1f.Quo(amt1f, exp1)
-	if amt0f.Cmp(big.NewFloat(0)) > 0 {
-		if p.B {
-			price.Quo(amt0f, amt1f)
-		} else {
-			price.Quo(amt1f, amt0f)
+// prints the pairs in ram which match the -q queries with their token addresses, by chain... used by -list
+func list_pairs(header map[int64]*ChainConfig, ram map[common.Address]Pair) {
+	addrs := make([]common.Address, 0, len(ram))
+	for key, val := range ram {
+		if val.matches(queryFlag) {
+			addrs = append(addrs, key)
 		}
 	}
-	return
+	sort.Slice(addrs, func(i, j int) bool {
+		pi, pj := ram[addrs[i]], ram[addrs[j]]
+		if pi.Chain != pj.Chain {
+			return pi.Chain < pj.Chain
+		}
+		if pi.S0 != pj.S0 {
+			return pi.S0 < pj.S0
+		}
+		return pi.S1 < pj.S1
+	})
+	d := len("symbol0")
+	for _, addr := range addrs {
+		if p := ram[addr]; d < p.width() {
+			d = p.width()
+		}
+	}
+	fmt.Printf("%-10s %-42s %-8s %-*s %-42s %-*s %s\n", "chain", "LP", "type", d, "symbol0", "token0", d, "symbol1", "token1")
+	for _, addr := range addrs {
+		p := ram[addr]
+		name := fmt.Sprint(p.Chain)
+		if head, ok := header[p.Chain]; ok == true {
+			name = head.Name
+		}
+		t0, t1 := p.T0, p.T1
+		if t0 == "" {
+			t0 = "-"
+		}
+		if t1 == "" {
+			t1 = "-"
+		}
+		fmt.Printf("%-10s %-42s %-8s %-*s %-42s %-*s %s\n", name, addr.String(), p.pool_type(), d, p.S0, t0, d, p.S1, t1)
+	}
+	fmt.Printf("%d pairs\n", len(addrs))
 }
 
-// prints a pair, returns the string and the color.
-func (p *Pair) String(d int) (s string, c *color.Color) {
-	amt0f, amt1f, price := p.amts()
-	var t1, t2, t3 string
-	my_red := color.New(color.FgHiRed)
-	my_green := color.New(color.FgGreen)
-	my_cyan := color.New(color.FgCyan)
-	my_yellow := color.New(color.FgYellow)
-
-	switch {
-	case p.mode == 0:
-		t1 = fmt.Sprintf("%12.4f %-*s  ->", amt0f, d+1, p.S0)
-		t2 = fmt.Sprintf("->%12.4f %-*s", amt1f, d, p.S1)
-		if p.B == true {
-			c = my_green
-		} else {
-			c = my_red
+// enumerates count pairs (or all of them when count is 0) of allPairs of the factory of every chain from the index from,
+// and adds the pairs missing from ram. the new tokens are fetched into registry. asks before fetching the pairs of
+// each factory... used by -discover
+func discover_pairs(header map[int64]*ChainConfig, ram map[common.Address]Pair, registry token_registry, from uint64, count uint64) (n int) {
+	for key, head := range header {
+		factory := head.Factory
+		if factory == "" {
+			continue
 		}
-	case p.mode == 1:
-		t1 = fmt.Sprintf("%12.4f %-*s  ->", amt1f, d+1, p.S1)
-		t2 = fmt.Sprintf("->%12.4f %-*s", amt0f, d, p.S0)
-		c = my_red
-		if p.B == true {
-			c = my_red
-		} else {
-			c = my_green
+		eps := new_chain_endpoints(key, head)
+		eps.check()
+		fmt.Print(eps.summary())
+		if err := eps.verify(); err != nil {
+			fmt.Printf("skipping the factory of %s blockchain (%v)\n", eps.name, err)
+			continue
 		}
-	case p.mode == 2:
-		t1 = fmt.Sprintf("%12.4f %-*s  ->", amt0f, d+1, p.S0)
-		t2 = fmt.Sprintf("<-%12.4f %-*s", amt1f, d, p.S1)
-		c = my_cyan
-	case p.mode == 3:
-		t1 = fmt.Sprintf("%12.4f %-*s  <-", amt0f, d+1, p.S0)
-		t2 = fmt.Sprintf("->%12.4f %-*s", amt1f, d, p.S1)
-		c = my_yellow
+		length, err := fetch_pairs_length(factory, eps)
+		if err != nil {
+			fmt.Printf("could not read the factory of %s blockchain (%v)\n", eps.name, err)
+			continue
+		}
+		to := length
+		if count > 0 && from+count < length {
+			to = from + count
+		}
+		if from >= to {
+			fmt.Printf("the %s factory has %d pairs, none from index %d\n", eps.name, length, from)
+			continue
+		}
+		fmt.Printf("the %s factory has %d pairs. Fetch pairs %d to %d? [press enter]", eps.name, length, from, to-1)
+		fmt.Scanln()
+		var entries []string
+		addrs, unread := fetch_all_pairs(factory, from, to, eps)
+		for _, addr := range addrs {
+			if _, ok := ram[addr]; ok == false {
+				entries = append(entries, addr.String())
+			}
+		}
+		pairs, failed := fetch_pairs(entries, key, head, registry.chain(key), eps)
+		for addr, p := range pairs {
+			ram[addr] = p
+		}
+		n += len(pairs)
+		// the pairs whose address could not be read from the factory failed too
+		for entry, err := range unread {
+			failed[entry] = err
+		}
+		print_failed(eps.name, failed)
 	}
-	t3 = fmt.Sprintf("%9.4f", price)
-	s = fmt.Sprintf("%s %s | %s", t1, t2, t3)
 	return
 }
 
-// the following three functions update the pair variable "p" based on the data in the Log Event. Will switch the mode of p depending on the event.
-func (p *Pair) swapUpdate(f []interface{}) {
-	var ell [4]*big.Int
-	for i, k := range f {
-		ell[i] = k.(*big.Int)
+// the filter of a single listener. new addresses can be added while listening, the listener picks them up without a restart.
+type live_query struct {
+	mu      sync.Mutex
+	query   ethereum.FilterQuery
+	changed chan struct{} // signalled (without blocking) whenever addresses are added
+}
+
+func new_live_query(query ethereum.FilterQuery) *live_query {
+	return &live_query{query: query, changed: make(chan struct{}, 1)}
+}
+
+// returns a copy of the current filter
+func (l *live_query) get() ethereum.FilterQuery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	query := l.query
+	query.Addresses = append([]common.Address{}, l.query.Addresses...)
+	return query
+}
+
+// adds addrs to the filter and tells the listener to resubscribe
+func (l *live_query) add(addrs ...common.Address) {
+	l.mu.Lock()
+	l.query.Addresses = append(l.query.Addresses, addrs...)
+	l.mu.Unlock()
+	select {
+	case l.changed <- struct{}{}:
+	default:
 	}
-	if ell[0].Cmp(big.NewInt(0)) == 0 {
-		// SELL
-		p.amt0 = ell[2]
-		p.amt1 = ell[1]
-		p.mode = 1
+}
+
+// listens to query on a single chain, over websocket when the chain has a wss endpoint and by polling its url otherwise.
+// the headers of the blocks of the forwarded logs are added to headers (unless it is nil), see header_cache.
+func listen(eps *chain_endpoints, head *ChainConfig, query *live_query, headers *header_cache, conf *confirmer, init func()) {
+	if eps.best_wss() != "" {
+		fmt.Fprintf(os.Stderr, "dialing %s blockchain...\n", eps.name)
+		listen_wss(eps, query, headers, conf, init)
+	} else if eps.best_http() != "" {
+		interval := default_poll_interval
+		if head.Poll != "" {
+			// the poll interval was checked when the ram file was loaded
+			interval, _ = time.ParseDuration(head.Poll)
+		}
+		fmt.Fprintf(os.Stderr, "polling %s blockchain every %s...\n", eps.name, interval)
+		listen_http(eps, query, headers, interval, conf, init)
 	} else {
-		// BUY
-		p.amt0 = ell[0]
-		p.amt1 = ell[3]
-		p.mode = 0
+		init()
 	}
 }
-func (p *Pair) mintUpdate(f []interface{}) {
-	var ell [2]*big.Int
-	for i, k := range f {
-		ell[i] = k.(*big.Int)
+
+// backoff used when reconnecting a dropped websocket. doubles after every failed attempt.
+const min_backoff = 1 * time.Second
+const max_backoff = 2 * time.Minute
+
+// the largest block range requested in a single FilterLogs call when backfilling. most public rpcs reject larger ranges.
+const backfill_chunk = 2000
+
+// log_cursor remembers how far into a chain the listener has forwarded logs, so a reconnect knows where to resume.
+type log_cursor struct {
+	block uint64 // block number of the last forwarded log
+	index uint   // index of the last forwarded log within block
+	whole bool   // true when every log of block has been seen (the cursor was set from a chain head)
+	ok    bool   // false until the first connection
+}
+
+// returns true if vLog comes after the cursor and should be forwarded
+func (c *log_cursor) after(vLog types.Log) bool {
+	if !c.ok || vLog.BlockNumber > c.block {
+		return true
 	}
-	p.amt0 = ell[0]
-	p.amt1 = ell[1]
-	p.mode = 2
+	return vLog.BlockNumber == c.block && !c.whole && vLog.Index > c.index
 }
-func (p *Pair) burnUpdate(f []interface{}) {
-	var ell [2]*big.Int
-	for i, k := range f {
-		ell[i] = k.(*big.Int)
+
+// moves the cursor to vLog
+func (c *log_cursor) advance(vLog types.Log) {
+	c.block = vLog.BlockNumber
+	c.index = vLog.Index
+	c.whole = false
+	c.ok = true
+}
+
+// moves the cursor back to the end of the block before n (if it isn't there already), so that after a reorg the logs of
+// the block replacing n are forwarded rather than taken for logs which were already seen
+func (c *log_cursor) rewind(n uint64) {
+	if n == 0 || (c.ok && n > c.block) {
+		return
 	}
-	p.amt0 = ell[0]
-	p.amt1 = ell[1]
-	p.mode = 3
+	c.block = n - 1
+	c.whole = true
+	c.ok = true
 }
 
-// fetches the symbol data by querying blockchain... part of bootstrap
-func fetch_symbol(coin_addr string, schan chan string, url string) {
-	tmpabi, _ := abi.JSON(strings.NewReader(`[{"inputs":[],"name":"symbol","outputs":[{"internalType":"string","name":"","type":"string"}],"stateMutability":"view","type":"function"}]`))
-	packed_bytes_0, _ := tmpabi.Pack("symbol")
-	result := ethCall(url, coin_addr, fmt.Sprintf("%#x", packed_bytes_0))
-	if body, err := hex.DecodeString(result[2:]); err == nil {
-		if f, err := tmpabi.Unpack("symbol", body); err == nil {
-			schan <- f[0].(string)
-		} else {
-			schan <- "ERROR"
-		}
+// moves the cursor to the end of block n (if it isn't there already)
+func (c *log_cursor) head(n uint64) {
+	if !c.ok || n > c.block {
+		c.block = n
+		c.whole = true
+		c.ok = true
 	}
+}
 
+// listens to a single chain over websocket and forwards every matching log to conf.
+// when the connection drops it reconnects with exponential backoff and replays the missed blocks with FilterLogs.
+// init is called once the first connection attempt has finished, whether it succeeded or not.
+// every reconnect fails over to the healthiest wss endpoint of the chain, as does a session whose endpoint falls
+// behind (see chain_endpoints.monitor).
+func listen_wss(eps *chain_endpoints, query *live_query, headers *header_cache, conf *confirmer, init func()) {
+	var cursor log_cursor
+	var once sync.Once
+	backoff := min_backoff
+	wss := eps.best_wss()
+	for {
+		err := wss_session(eps, wss, query, &cursor, headers, conf, func() {
+			backoff = min_backoff
+			once.Do(init)
+		})
+		once.Do(init)
+		fmt.Fprintf(os.Stderr, "lost connection to %s blockchain at %s (%v), reconnecting in %s...\n", eps.name, wss, err, backoff)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > max_backoff {
+			backoff = max_backoff
+		}
+		eps.demote(wss)
+		eps.check()
+		if next := eps.best_wss(); next != wss {
+			fmt.Fprintf(os.Stderr, "failing over %s blockchain to %s\n", eps.name, next)
+			wss = next
+		}
+	}
 }
 
-// uses ethCall() to get the pair of tokens by querying the LP contract... part of bootstrap
-func fetch_tokens(lp_addr string, tok0c chan string, tok1c chan string, url string) {
-	tmpabi, _ := abi.JSON(strings.NewReader(`[{"inputs":[],"name":"token0","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"token1","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"view","type":"function"}]`))
-	go func() {
-		packed_bytes, _ := tmpabi.Pack("token0")
-		result := ethCall(url, lp_addr, fmt.Sprintf("%#x", packed_bytes))
-		if body, err := hex.DecodeString(result[2:]); err == nil {
-			if f, err := tmpabi.Unpack("token0", body); err == nil {
-				for {
-					tok0c <- (f[0].(common.Address)).String()
-				}
-			} else {
-				panic(err)
+// the poll interval for chains without a websocket endpoint, unless the chain sets "poll" in its header
+const default_poll_interval = 5 * time.Second
+
+// listens to a single chain over http for chains without a websocket endpoint.
+// every interval it asks for the current block with eth_blockNumber and fetches the logs of the new blocks with eth_getLogs.
+// failed polls are retried on the next tick against the healthiest http endpoint, starting from the last block that was fully fetched.
+// init is called once the starting block is known (or the first attempt to get it failed).
+// addresses added to query are included from the next poll on.
+// eth_getLogs never returns removed logs, so every poll also fetches the last reorg_window blocks again to catch reorgs,
+// see poll_reorgs. the headers of the blocks of new logs are fetched into headers before the logs are forwarded.
+func listen_http(eps *chain_endpoints, query *live_query, headers *header_cache, interval time.Duration, conf *confirmer, init func()) {
+	var cursor log_cursor
+	var once sync.Once
+	name := eps.name
+	// the first block polled, and the logs forwarded from the last reorg_window blocks
+	var first uint64
+	seen := make(map[polled_key]types.Log)
+	// the addresses of the query as of the last poll
+	var known map[common.Address]bool
+	for ; ; time.Sleep(interval) {
+		url := eps.best_http()
+		var current hexutil.Uint64
+		if err := rpcCall(url, "eth_blockNumber", []interface{}{}, &current); err != nil {
+			once.Do(init)
+			fmt.Fprintf(os.Stderr, "polling %s blockchain at %s failed (%v), retrying in %s...\n", name, url, err, interval)
+			eps.demote(url)
+			eps.check()
+			continue
+		}
+		once.Do(init)
+		if !cursor.ok {
+			cursor.head(uint64(current))
+			first = cursor.block + 1
+			continue
+		}
+
+		filter := query.get()
+		if known == nil {
+			known = address_set(filter)
+		}
+		if start := window_start(cursor.block, first); start <= cursor.block {
+			n, err := poll_reorgs(url, filter, known, seen, start, cursor.block, headers, conf)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "polling %s blockchain at %s failed (%v), retrying in %s...\n", name, url, err, interval)
+				eps.demote(url)
+				continue
+			}
+			if n > 0 {
+				fmt.Fprintf(os.Stderr, "reorg on %s blockchain, %d events removed\n", name, n)
 			}
 		}
-	}()
-	go func() {
-		packed_bytes, _ := tmpabi.Pack("token1")
-		result := ethCall(url, lp_addr, fmt.Sprintf("%#x", packed_bytes))
-		if body, err := hex.DecodeString(result[2:]); err == nil {
-			if f, err := tmpabi.Unpack("token1", body); err == nil {
-				for {
-					tok1c <- (f[0].(common.Address)).String()
-				}
-			} else {
-				panic(err)
+		known = address_set(filter)
+		for from := cursor.block + 1; from <= uint64(current); from = cursor.block + 1 {
+			to := from + backfill_chunk - 1
+			if to > uint64(current) {
+				to = uint64(current)
+			}
+			var fetched []types.Log
+			if err := rpcCall(url, "eth_getLogs", []interface{}{to_filter_arg(filter, from, to)}, &fetched); err != nil {
+				fmt.Fprintf(os.Stderr, "polling %s blockchain at %s failed (%v), retrying in %s...\n", name, url, err, interval)
+				eps.demote(url)
+				break
+			}
+			headers.fetch(fetched)
+			for _, vLog := range fetched {
+				seen[polled_key{vLog.BlockHash, vLog.Index}] = vLog
+				conf.add(vLog)
 			}
+			cursor.head(to)
 		}
-	}()
+		conf.head(cursor.block)
+		start := window_start(cursor.block, first)
+		for key, vLog := range seen {
+			if vLog.BlockNumber < start {
+				delete(seen, key)
+			}
+		}
+	}
 }
 
-// uses ethCall() to get decimal information from blockchain... part of bootstrap
-func fetch_decimals(coin_addr string, dchan chan byte, url string) {
-	tmpabi, _ := abi.JSON(strings.NewReader(`[{"inputs":[],"name":"decimals","outputs":[{"internalType":"uint8","name":"","type":"uint8"}],"stateMutability":"view","type":"function"}]`))
-	packed_bytes_0, _ := tmpabi.Pack("decimals")
-	result := ethCall(url, coin_addr, fmt.Sprintf("%#x", packed_bytes_0))
-	if body, err := hex.DecodeString(result[2:]); err == nil {
-		if f, err := tmpabi.Unpack("decimals", body); err == nil {
-			dchan <- f[0].(byte)
-		} else {
-			dchan <- byte(18)
-		}
+// how many blocks below the head of a polled chain are checked for reorgs. deeper reorgs go unnoticed.
+const reorg_window = 64
+
+// identifies a log of a polled chain. the block hash tells the log apart from the one at the same index of the block
+// which replaced it in a reorg.
+type polled_key struct {
+	block common.Hash
+	index uint
+}
+
+// the first block of the reorg window of a polled chain whose cursor is at block, and which was first polled at first
+func window_start(block uint64, first uint64) uint64 {
+	if block+1 < first+reorg_window {
+		return first
 	}
+	return block + 1 - reorg_window
 }
 
-// loads ram from ram file
-func load_ram_from_ram_file(filename string) (header map[int64]interface{}, ram map[common.Address]Pair, err error) {
-	if f, ok := os.Open(filename); os.IsNotExist(ok) {
-		f.Close()
+func address_set(filter ethereum.FilterQuery) map[common.Address]bool {
+	set := make(map[common.Address]bool)
+	for _, addr := range filter.Addresses {
+		set[addr] = true
+	}
+	return set
+}
+
+// fetches the logs of the blocks from..to again and compares them with the logs forwarded from those blocks in seen.
+// the logs which are gone were dropped by a reorg and are passed on as removed (newest first, like a websocket
+// subscription does), then the new logs of the blocks which replaced them are forwarded. logs of the addresses added
+// to the query since the last poll (not in known) are only remembered, as they were never missed.
+// returns the number of removed logs.
+func poll_reorgs(url string, filter ethereum.FilterQuery, known map[common.Address]bool, seen map[polled_key]types.Log, from uint64, to uint64, headers *header_cache, conf *confirmer) (n int, err error) {
+	var fetched []types.Log
+	if err = rpcCall(url, "eth_getLogs", []interface{}{to_filter_arg(filter, from, to)}, &fetched); err != nil {
 		return
-	} else {
-		defer f.Close()
-		r := json.NewDecoder(f)
-		var j [2]interface{}
-		err = r.Decode(&j)
-		if err != nil {
-			return
+	}
+	canonical := make(map[polled_key]bool)
+	for _, vLog := range fetched {
+		canonical[polled_key{vLog.BlockHash, vLog.Index}] = true
+	}
+	var gone []types.Log
+	for key, vLog := range seen {
+		if vLog.BlockNumber >= from && vLog.BlockNumber <= to && !canonical[key] {
+			gone = append(gone, vLog)
+			delete(seen, key)
 		}
-		header = make(map[int64]interface{})
-		ram = make(map[common.Address]Pair)
-		b1, b2 := bytes.NewBuffer(nil), bytes.NewBuffer(nil)
-		t1, t2 := json.NewEncoder(b1), json.NewEncoder(b2)
-		t1.Encode(j[0])
-		t2.Encode(j[1])
-		s1, s2 := json.NewDecoder(b1), json.NewDecoder(b2)
-		s1.Decode(&header)
-		s2.Decode(&ram)
 	}
-	return
+	sort.Slice(gone, func(i, k int) bool {
+		if gone[i].BlockNumber != gone[k].BlockNumber {
+			return gone[i].BlockNumber > gone[k].BlockNumber
+		}
+		return gone[i].Index > gone[k].Index
+	})
+	for _, vLog := range gone {
+		vLog.Removed = true
+		conf.add(vLog)
+	}
+	var fresh []types.Log
+	for _, vLog := range fetched {
+		key := polled_key{vLog.BlockHash, vLog.Index}
+		if _, ok := seen[key]; ok == true {
+			continue
+		}
+		seen[key] = vLog
+		if known[vLog.Address] {
+			fresh = append(fresh, vLog)
+		}
+	}
+	headers.fetch(fresh)
+	for _, vLog := range fresh {
+		conf.add(vLog)
+	}
+	return len(gone), nil
 }
 
-// saves ram to a ram file
-func save_ram_to_ram_file(header map[int64]interface{}, ram map[common.Address]Pair, filename string) (err error) {
-	f, err := os.Create(filename)
-	defer f.Close()
-	if err != nil {
-		return
+// builds the eth_getLogs parameter object for query over the blocks from..to
+func to_filter_arg(query ethereum.FilterQuery, from uint64, to uint64) map[string]interface{} {
+	arg := map[string]interface{}{
+		"address":   query.Addresses,
+		"topics":    query.Topics,
+		"fromBlock": hexutil.EncodeUint64(from),
+		"toBlock":   hexutil.EncodeUint64(to),
 	}
-	r := json.NewEncoder(f)
-	r.SetIndent("", "  ")
-	err = r.Encode([]interface{}{header, ram})
-	return
+	return arg
 }
 
-// uses ram file to create a bootstrap file
-func save_bootstrap_file(header map[int64]interface{}, ram map[common.Address]Pair, filename string) (err error) {
-	f, err := os.Create(filename)
-	defer f.Close()
+// a single websocket connection. returns when the subscription fails.
+// after a reconnect, the blocks between the cursor and the current head are backfilled before live logs are forwarded.
+// when addresses are added to live, the logs are resubscribed on the same connection.
+// every new head is added to headers (unless it is nil).
+// the session also ends when the periodic health check finds wss lagging behind another endpoint of the chain.
+func wss_session(eps *chain_endpoints, wss string, live *live_query, cursor *log_cursor, headers *header_cache, conf *confirmer, connected func()) (err error) {
+	ctx := context.Background()
+	conn, err := rpc.DialContext(ctx, wss)
 	if err != nil {
 		return
 	}
-	r := json.NewEncoder(f)
-	r.SetIndent("", "  ")
-	bootstrap := make(map[int64]interface{})
-	for key, val := range ram {
-		if try, ok := bootstrap[val.Chain].(map[string]interface{}); ok == false {
-			try = make(map[string]interface{})
-			head := header[val.Chain].(map[string]interface{})
-			try["name"] = head["name"].(string)
-			try["url"] = head["url"].(string)
-			try["wss"] = head["wss"].(string)
-			try["data"] = []string{key.String()}
-			bootstrap[val.Chain] = try
-		} else {
-			s := try["data"].([]string)
-			s = append(s, key.String())
-			try["data"] = s
-			bootstrap[val.Chain] = try
+	client := ethclient.NewClient(conn)
+	defer client.Close()
+	this_chain_logs := make(chan types.Log)
+	query := live.get()
+	sub, err := client.SubscribeFilterLogs(ctx, query, this_chain_logs)
+	if err != nil {
+		return
+	}
+	defer func() { sub.Unsubscribe() }()
+	// heads are needed to release events held for confirmations, and to annotate events without fetching their block
+	// (subscribed to without ethclient, which drops the hash of each head)
+	var heads chan *chain_header
+	var head_errs <-chan error
+	if conf.depth > 0 || headers != nil {
+		heads = make(chan *chain_header)
+		hsub, err := conn.EthSubscribe(ctx, heads, "newHeads")
+		if err != nil {
+			return err
 		}
+		defer hsub.Unsubscribe()
+		head_errs = hsub.Err()
 	}
-	err = r.Encode(bootstrap)
-	return
-}
-
-// loads the bootstrap file by calling the blockchain to get the symbol and decimal metadata
-func load_bootstrap_file(filename string) (ram_header map[int64]interface{}, ram map[common.Address]Pair, err error) {
-	bootstrap := make(map[int64]interface{})
-	if f, ok := os.Open(filename); ok != nil {
+	current, err := client.BlockNumber(ctx)
+	if err != nil {
+		return
+	}
+	connected()
+	if cursor.ok {
+		// the subscription is already live, so anything up to the current head is missing
+		n, err := backfill(ctx, client, query, cursor, headers, conf, current)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "reconnected to %s blockchain, backfilled %d events\n", eps.name, n)
+	}
+	cursor.head(current)
+	conf.head(current)
+	health := time.NewTicker(health_interval)
+	defer health.Stop()
+	for {
+		select {
+		case <-health.C:
+			if lag, ok := eps.lagging(wss); ok == true {
+				return fmt.Errorf("%d blocks behind the best endpoint", lag)
+			}
+		case err := <-sub.Err():
+			if err == nil {
+				err = fmt.Errorf("subscription closed")
+			}
+			return err
+		case err := <-head_errs:
+			if err == nil {
+				err = fmt.Errorf("head subscription closed")
+			}
+			return err
+		case h := <-heads:
+			if headers != nil {
+				headers.add(h)
+			}
+			conf.head(h.head.Number.Uint64())
+		case <-live.changed:
+			sub.Unsubscribe()
+			query = live.get()
+			next, err := client.SubscribeFilterLogs(ctx, query, this_chain_logs)
+			if err != nil {
+				return err
+			}
+			sub = next
+			// logs emitted while resubscribing would otherwise be lost
+			if current, err = client.BlockNumber(ctx); err != nil {
+				return err
+			}
+			if _, err = backfill(ctx, client, query, cursor, headers, conf, current); err != nil {
+				return err
+			}
+		case vLog := <-this_chain_logs:
+			// removed logs refer to blocks we have already passed, let them through and make way for their replacements
+			if vLog.Removed {
+				cursor.rewind(vLog.BlockNumber)
+				conf.add(vLog)
+			} else if cursor.after(vLog) {
+				cursor.advance(vLog)
+				conf.add(vLog)
+			}
+		}
+	}
+}
+
+// forwards the logs matching query between the cursor and the block current that come after the cursor, in chunks.
+// the new heads of the missed blocks never came in, so their headers are fetched into headers first.
+func backfill(ctx context.Context, client *ethclient.Client, query ethereum.FilterQuery, cursor *log_cursor, headers *header_cache, conf *confirmer, current uint64) (n int, err error) {
+	for from := cursor.block; from <= current; from += backfill_chunk {
+		to := from + backfill_chunk - 1
+		if to > current {
+			to = current
+		}
+		q := query
+		q.FromBlock = new(big.Int).SetUint64(from)
+		q.ToBlock = new(big.Int).SetUint64(to)
+		missed, err := client.FilterLogs(ctx, q)
+		if err != nil {
+			return n, err
+		}
+		var fresh []types.Log
+		for _, vLog := range missed {
+			if cursor.after(vLog) {
+				cursor.advance(vLog)
+				fresh = append(fresh, vLog)
+			}
+		}
+		headers.fetch(fresh)
+		for _, vLog := range fresh {
+			conf.add(vLog)
+		}
+		n += len(fresh)
+	}
+	return
+}
+
+// confirmer holds the logs of a single chain until the chain head is depth blocks past them.
+// with a depth of 0 every log is forwarded straight away. it is only used by the goroutine listening to its chain.
+type confirmer struct {
+	depth   uint64
+	pending map[uint64][]types.Log // held logs keyed by block number
+	logs    chan types.Log
+}
+
+func new_confirmer(depth uint64, logs chan types.Log) *confirmer {
+	return &confirmer{depth: depth, pending: make(map[uint64][]types.Log), logs: logs}
+}
+
+// holds vLog until it is confirmed. a removed log which is still held is simply dropped,
+// while one which was already forwarded is passed on so the handler can revert it.
+func (c *confirmer) add(vLog types.Log) {
+	if c.depth == 0 {
+		c.logs <- vLog
+		return
+	}
+	if vLog.Removed {
+		held := c.pending[vLog.BlockNumber]
+		for i, tmp := range held {
+			if tmp.TxHash == vLog.TxHash && tmp.Index == vLog.Index {
+				c.pending[vLog.BlockNumber] = append(held[:i:i], held[i+1:]...)
+				return
+			}
+		}
+		c.logs <- vLog
+		return
+	}
+	c.pending[vLog.BlockNumber] = append(c.pending[vLog.BlockNumber], vLog)
+}
+
+// forwards every held log which is at least depth blocks below the head n, oldest first
+func (c *confirmer) head(n uint64) {
+	if n < c.depth {
+		return
+	}
+	var blocks []uint64
+	for block := range c.pending {
+		if block <= n-c.depth {
+			blocks = append(blocks, block)
+		}
+	}
+	sort.Slice(blocks, func(i, k int) bool { return blocks[i] < blocks[k] })
+	for _, block := range blocks {
+		held := c.pending[block]
+		sort.Slice(held, func(i, k int) bool { return held[i].Index < held[k].Index })
+		for _, vLog := range held {
+			c.logs <- vLog
+		}
+		delete(c.pending, block)
+	}
+}
+
+// headers holds the header cache of every chain, which events are annotated with
+func vLog_handler(ram map[common.Address]Pair, contracts map[string]abi.ABI, j *journal, out *output, headers map[int64]*header_cache, vLog types.Log, d int) {
+	if vLog.Removed {
+		// the block holding this log was dropped by a reorg
+		if e, restore, ok := j.revert(event_key{vLog.TxHash, vLog.Index}); ok == true {
+			if restore {
+				ram[e.pair] = e.prev
+			}
+			if e.event != nil {
+				out.revert(*e.event, e.line)
+			}
+		}
+		return
+	}
+	// swaps of balancer pools come from the vault. the pool address is the first 20 bytes of the poolId topic.
+	addr := vLog.Address
+	if vLog.Topics[0] == contracts["balancer"].Events["Swap"].ID && len(vLog.Topics) > 1 {
+		addr = common.BytesToAddress(vLog.Topics[1].Bytes()[:common.AddressLength])
+	}
+	p := ram[addr]
+	prev := p
+	contract := contracts[p.pool_type()]
+	e, err := contract.EventByID(vLog.Topics[0])
+	if err != nil {
+		panic(err)
+	}
+	// the pair as it should be shown, nil when there is nothing to show
+	var v *Pair
+	if p.Type == "curve" {
+		// curve events are overloaded by the number of coins, so go by the raw name
+		if f, err := contract.Unpack(e.Name, vLog.Data); err == nil {
+			v = p.curveUpdate(e.RawName, f)
+		}
+	}
+	switch e.Name {
+	case "Swap":
+		if f, err := contract.Unpack("Swap", vLog.Data); err == nil {
+			switch p.Type {
+			case "v3":
+				p.v3SwapUpdate(f)
+				v = &p
+			case "balancer":
+				v = p.balancerUpdate(vLog.Topics, f)
+			default:
+				p.swapUpdate(f)
+				v = &p
+			}
+		}
+	// for both pool types the token amounts are the last two non-indexed fields
+	case "Mint":
+		if f, err := contract.Unpack("Mint", vLog.Data); err == nil {
+			p.mintUpdate(f[len(f)-2:])
+			v = &p
+		}
+	case "Burn":
+		if f, err := contract.Unpack("Burn", vLog.Data); err == nil {
+			p.burnUpdate(f[len(f)-2:])
+			v = &p
+		}
+	case "Collect":
+		if f, err := contract.Unpack("Collect", vLog.Data); err == nil {
+			p.collectUpdate(f[len(f)-2:])
+			v = &p
+		}
+	case "Sync":
+		// emitted right before every Swap, Mint and Burn. only the reserves are kept, nothing is printed.
+		if f, err := contract.Unpack("Sync", vLog.Data); err == nil {
+			p.syncUpdate(f)
+			ram[addr] = p
+			j.add(event_key{vLog.TxHash, vLog.Index}, journal_entry{pair: addr, prev: prev})
+		}
+		return
+	}
+	if v == nil {
+		return
+	}
+	ram[addr] = p
+	now := time.Now().In(out.loc)
+	ev := v.event(addr, vLog, now)
+	// the listener of the chain cached the header before forwarding the log, unless it could not be fetched
+	if hc := headers[p.Chain]; hc != nil {
+		if head, ok := hc.peek(vLog.BlockNumber, vLog.BlockHash); ok == true {
+			ev.annotate(head, out.loc)
+		}
+	}
+	stamp := now.Format("15:04:05")
+	if out.block_time {
+		if ev.BlockTime != nil {
+			stamp = fmt.Sprintf("%s %+5.1fs", ev.BlockTime.Format("15:04:05"), *ev.Lag)
+		} else {
+			stamp += fmt.Sprintf(" %6s", "")
+		}
+	}
+	s, c := v.String(d)
+	line := fmt.Sprintf("%s | %s @ %s | %s", s, stamp, addr.String()[:6], fmt.Sprintf("%#x", vLog.TxHash)[:6])
+	out.print(ev, line, c)
+	j.add(event_key{vLog.TxHash, vLog.Index}, journal_entry{line: line, event: &ev, pair: addr, prev: prev})
+}
+
+// where decoded events go: coloured rows on the terminal, or one JSON object per line with -output=jsonl,
+// and the CSV files of -csv
+type output struct {
+	jsonl *json.Encoder  // nil for text output
+	csv   *csv_writer    // nil without -csv
+	loc   *time.Location // the time zone of every printed time
+	// print the time of the block of each event (and the lag) instead of the time it was received
+	block_time bool
+}
+
+// tz is a time zone name as understood by time.LoadLocation, csv_dir may be empty, csv_size is in bytes
+func new_output(format string, tz string, block_time bool, csv_dir string, csv_size int64) (o *output, err error) {
+	o = &output{block_time: block_time}
+	if o.loc, err = time.LoadLocation(tz); err != nil {
+		return nil, fmt.Errorf("unknown time zone %q (%v)", tz, err)
+	}
+	switch format {
+	case "text":
+	case "jsonl":
+		o.jsonl = json.NewEncoder(os.Stdout)
+	default:
+		return nil, fmt.Errorf("unknown output format %q, expected text or jsonl", format)
+	}
+	if csv_dir != "" {
+		if o.csv, err = new_csv_writer(csv_dir, csv_size); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// prints an event, as the row line in colour c or as a json line
+func (o *output) print(e Event, line string, c *color.Color) {
+	if o.csv != nil {
+		if err := o.csv.add(e); err != nil {
+			fmt.Fprintf(os.Stderr, "could not write %s (%v)\n", o.csv.name(), err)
+		}
+	}
+	if o.jsonl == nil {
+		if e.Removed {
+			color.New(color.FgMagenta).Printf("%s | REVERTED\n", line)
+		} else {
+			c.Println(line)
+		}
+		return
+	}
+	if err := o.jsonl.Encode(e); err != nil {
+		fmt.Fprintf(os.Stderr, "could not write event (%v)\n", err)
+	}
+}
+
+// prints an event which was undone by a reorg
+func (o *output) revert(e Event, line string) {
+	e.Removed = true
+	o.print(e, line, nil)
+}
+
+// flushes and closes the CSV file, if any
+func (o *output) close() {
+	if o.csv == nil {
+		return
+	}
+	if err := o.csv.close(); err != nil {
+		fmt.Fprintf(os.Stderr, "could not close %s (%v)\n", o.csv.name(), err)
+	}
+}
+
+// the columns of the CSV files. new columns go at the end so that older files keep lining up.
+var csv_header = []string{"time", "chain_id", "block", "log_index", "lp", "tx", "type", "symbol0", "token0", "amount0_raw", "amount0",
+	"symbol1", "token1", "amount1_raw", "amount1", "price", "spot", "impact", "fee", "extra", "removed", "block_time", "lag",
+	"base_fee", "miner"}
+
+// writes events to dir/events-YYYY-MM-DD.csv, one file per (UTC) day. with max set, a full file is followed by
+// events-YYYY-MM-DD.1.csv, events-YYYY-MM-DD.2.csv and so on. existing files are appended to.
+type csv_writer struct {
+	dir  string
+	max  int64 // in bytes, 0 for no limit
+	day  string
+	part int
+	f    *os.File
+	w    *csv.Writer
+	size int64 // the size of f, counted as the csv.Writer writes through Write
+}
+
+func new_csv_writer(dir string, max int64) (*csv_writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &csv_writer{dir: dir, max: max}, nil
+}
+
+func (c *csv_writer) name() string {
+	if c.part == 0 {
+		return filepath.Join(c.dir, fmt.Sprintf("events-%s.csv", c.day))
+	}
+	return filepath.Join(c.dir, fmt.Sprintf("events-%s.%d.csv", c.day, c.part))
+}
+
+func (c *csv_writer) Write(b []byte) (int, error) {
+	n, err := c.f.Write(b)
+	c.size += int64(n)
+	return n, err
+}
+
+// makes sure the open file is the one for the day of t and isn't full
+func (c *csv_writer) rotate(t time.Time) error {
+	day := t.UTC().Format("2006-01-02")
+	if c.f != nil && day == c.day && (c.max == 0 || c.size < c.max) {
+		return nil
+	}
+	if err := c.close(); err != nil {
+		fmt.Fprintf(os.Stderr, "could not close %s (%v)\n", c.name(), err)
+	}
+	if day != c.day {
+		c.day, c.part = day, 0
+	} else {
+		c.part++
+	}
+	for {
+		f, err := os.OpenFile(c.name(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if c.max > 0 && info.Size() >= c.max {
+			// filled before a restart
+			f.Close()
+			c.part++
+			continue
+		}
+		c.f, c.size = f, info.Size()
+		break
+	}
+	c.w = csv.NewWriter(c)
+	if c.size == 0 {
+		c.w.Write(csv_header)
+	}
+	return nil
+}
+
+// writes an event and flushes it to the file
+func (c *csv_writer) add(e Event) error {
+	if err := c.rotate(e.Time); err != nil {
+		return err
+	}
+	var block_time string
+	if e.BlockTime != nil {
+		block_time = e.BlockTime.Format(time.RFC3339)
+	}
+	var extra []string
+	for _, x := range e.Extra {
+		extra = append(extra, x.Amount+" "+x.Symbol)
+	}
+	c.w.Write([]string{
+		e.Time.Format(time.RFC3339), strconv.FormatInt(e.Chain, 10), strconv.FormatUint(e.Block, 10), strconv.FormatUint(uint64(e.Index), 10),
+		e.LP, e.Tx, e.Type, e.Symbol0, e.Token0, e.Raw0, e.Amount0, e.Symbol1, e.Token1, e.Raw1, e.Amount1,
+		csv_float(e.Price), csv_float(e.Spot), csv_float(e.Impact), csv_float(e.Fee), strings.Join(extra, "; "), strconv.FormatBool(e.Removed),
+		block_time, csv_float(e.Lag), e.BaseFee, e.Miner,
+	})
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// flushes and closes the open file, if any
+func (c *csv_writer) close() error {
+	if c.f == nil {
+		return nil
+	}
+	c.w.Flush()
+	err := c.w.Error()
+	if cerr := c.f.Close(); err == nil {
+		err = cerr
+	}
+	c.f = nil
+	return err
+}
+
+// an optional number of an Event, empty when it is missing
+func csv_float(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'g', -1, 64)
+}
+
+// the number of printed events remembered in case a reorg reverts them
+const journal_size = 4096
+
+// identifies a single log
+type event_key struct {
+	tx    common.Hash
+	index uint
+}
+
+// an event which has been printed and applied to a pair
+type journal_entry struct {
+	line  string         // the printed row, empty for events which are not printed
+	event *Event         // the decoded event, nil for events which are not printed
+	pair  common.Address // the pair the event was applied to
+	prev  Pair           // the pair as it was before the event
+}
+
+// journal remembers recently printed events so that removed logs (from chain reorgs) can be matched to them and undone
+type journal struct {
+	entries map[event_key]journal_entry
+	order   []event_key                    // every recorded key, oldest first. used to evict old entries
+	applied map[common.Address][]event_key // the events still standing on each pair, oldest first
+}
+
+func new_journal() *journal {
+	return &journal{entries: make(map[event_key]journal_entry), applied: make(map[common.Address][]event_key)}
+}
+
+// records an event which was just applied to a pair
+func (j *journal) add(key event_key, e journal_entry) {
+	j.entries[key] = e
+	j.order = append(j.order, key)
+	j.applied[e.pair] = append(j.applied[e.pair], key)
+	if len(j.order) > journal_size {
+		old := j.order[0]
+		j.order = j.order[1:]
+		if tmp, ok := j.entries[old]; ok == true {
+			delete(j.entries, old)
+			j.applied[tmp.pair] = remove_key(j.applied[tmp.pair], old)
+		}
+	}
+}
+
+// forgets a reverted event and returns it. restore is true if the event was the latest one applied to its pair,
+// in which case the pair should be set back to e.prev. otherwise the later events keep the pair as it is.
+func (j *journal) revert(key event_key) (e journal_entry, restore bool, ok bool) {
+	if e, ok = j.entries[key]; ok == false {
+		return
+	}
+	delete(j.entries, key)
+	keys := j.applied[e.pair]
+	for i, k := range keys {
+		if k != key {
+			continue
+		}
+		if i == len(keys)-1 {
+			restore = true
+		} else {
+			// the next event's snapshot includes this one, so hand it the older snapshot instead
+			next := j.entries[keys[i+1]]
+			next.prev = e.prev
+			j.entries[keys[i+1]] = next
+		}
+		break
+	}
+	j.applied[e.pair] = remove_key(keys, key)
+	return
+}
+
+// removes key from keys
+func remove_key(keys []event_key, key event_key) []event_key {
+	for i, k := range keys {
+		if k == key {
+			return append(keys[:i:i], keys[i+1:]...)
+		}
+	}
+	return keys
+}
+
+// amt0 should be the "stable" half of the pair (depending on the context...)
+// amt0 amt1 will constantly be updated
+// B is the "normal" parameter which can be changed (change this in the ram file) to flip the "direction" of a pair.
+type Pair struct {
+	S0    string `json:"symbol0,omitempty"`
+	S1    string `json:"symbol1,omitempty"`
+	D0    byte   `json:"decimals0,omitempty"`
+	D1    byte   `json:"decimals1,omitempty"`
+	amt0  *big.Int
+	amt1  *big.Int
+	Chain int64 `json:"chainID"`
+	B     bool  `json:"normal"`
+	// one byte for the mode: 0 buy 1 sell 2 make 3 break 4 flash/complex (amt0 amt1 are signed net flows into the pool) 5 collect
+	mode byte
+	// the pool reserves as of the last Sync event, nil until the first one
+	r0 *big.Int
+	r1 *big.Int
+	// the kind of pool, detected during bootstrap: "v2" (the default when empty), "v3" for concentrated liquidity pools,
+	// "curve" for stableswap pools or "balancer" for pools of a balancer vault
+	Type string `json:"type,omitempty"`
+	// the fee tier of a v3 pool in hundredths of a bip, e.g. 3000 for 0.3%
+	Fee uint32 `json:"fee,omitempty"`
+	// v3 pools: the price after the last swap, the one before it, and the active liquidity
+	sqrtP      *big.Int
+	prev_sqrtP *big.Int
+	liq        *big.Int
+	// curve pools: every coin indexed like coins(i), and the underlying coins of lending/meta pools indexed like underlying_coins(i).
+	// S0 S1 D0 D1 hold the first two coins.
+	Coins      []Coin `json:"coins,omitempty"`
+	Underlying []Coin `json:"underlying,omitempty"`
+	// solidly/velodrome pairs with stable() set price along x^3y + y^3x = k instead of x*y = k
+	Stable bool `json:"stable,omitempty"`
+	// balancer pools: the id of the pool in the vault. Coins holds its tokens in vault order.
+	PoolID string `json:"poolId,omitempty"`
+	// curve pools: the amounts of the coins after the first two in the last liquidity event
+	extra []*big.Int
+	// the addresses of token0 and token1 (the first two coins of curve and balancer pools).
+	// when set, S0 S1 D0 D1 are kept in the token registry instead of the ram file.
+	T0 string `json:"token0,omitempty"`
+	T1 string `json:"token1,omitempty"`
+}
+
+// a single coin of a curve pool. the symbol and decimals are kept in the token registry instead of the ram file.
+type Coin struct {
+	Addr string `json:"address"`
+	S    string `json:"symbol,omitempty"`
+	D    byte   `json:"decimals,omitempty"`
+}
+
+// returns true if the tokens of the pair match one of the queries (TOKEN or TOKEN0:TOKEN1).
+// a token is matched by symbol prefix, or by address when it is given as a full address.
+// every pair matches when there are no queries.
+func (p *Pair) matches(queries []string) bool {
+	if len(queries) == 0 {
+		return true
+	}
+	t0 := token_ref{p.S0, p.T0}
+	t1 := token_ref{p.S1, p.T1}
+	var b bool
+	for _, q := range queries {
+		ss := strings.Split(q, ":")
+		switch len(ss) {
+		case 1:
+			b = b || t0.matches(ss[0]) || t1.matches(ss[0])
+			// the other coins of curve and balancer pools only match by address
+			for _, c := range append(append([]Coin{}, p.Coins...), p.Underlying...) {
+				b = b || (common.IsHexAddress(ss[0]) && token_ref{"", c.Addr}.matches(ss[0]))
+			}
+		case 2:
+			bt0 := t0.matches(ss[0]) && t1.matches(ss[1])
+			bt1 := t1.matches(ss[0]) && t0.matches(ss[1])
+			b = b || bt0 || bt1
+		}
+	}
+	return b
+}
+
+// a token of a pair as seen by a query: its symbol, and its address when known
+type token_ref struct {
+	symbol string
+	addr   string
+}
+
+// a full address matches the token with that address, anything else is a symbol prefix
+func (t token_ref) matches(q string) bool {
+	if common.IsHexAddress(q) {
+		return t.addr != "" && common.HexToAddress(q) == common.HexToAddress(t.addr)
+	}
+	return strings.HasPrefix(strings.ToLower(t.symbol), strings.ToLower(q))
+}
+
+// the length of the longest symbol of the pair, used to align the output
+func (p *Pair) width() (d int) {
+	for _, s := range []string{p.S0, p.S1} {
+		if d < len(s) {
+			d = len(s)
+		}
+	}
+	for _, coin := range append(append([]Coin{}, p.Coins...), p.Underlying...) {
+		if d < len(coin.S) {
+			d = len(coin.S)
+		}
+	}
+	return
+}
+
+// the pool type of the pair, used to pick the ABI of its events
+func (p *Pair) pool_type() string {
+	if p.Type == "" {
+		return "v2"
+	}
+	return p.Type
+}
+
+// converts a v3 sqrtPriceX96 into the price of token0 in token1, renormalized using the decimals
+func sqrt_price(sqrtP *big.Int, d0 byte, d1 byte) *big.Float {
+	exp0 := (&big.Float{}).SetInt((&big.Int{}).Exp(big.NewInt(10), big.NewInt(int64(d0)), nil))
+	exp1 := (&big.Float{}).SetInt((&big.Int{}).Exp(big.NewInt(10), big.NewInt(int64(d1)), nil))
+	q96 := (&big.Float{}).SetInt((&big.Int{}).Lsh(big.NewInt(1), 96))
+	root := (&big.Float{}).SetInt(sqrtP)
+	root.Quo(root, q96)
+	price := (&big.Float{}).Mul(root, root)
+	price.Mul(price, exp0)
+	return price.Quo(price, exp1)
+}
+
+// uses the raw *big.Int data and generates *big.Float data, appropriately renormalized using the "decimal" data
+func (p *Pair) amts() (amt0f *big.Float, amt1f *big.Float, price *big.Float) {
+	exp0 := (&big.Float{}).SetInt((&big.Int{}).Exp(big.NewInt(10), big.NewInt(int64(p.D0)), nil))
+	exp1 := (&big.Float{}).SetInt((&big.Int{}).Exp(big.NewInt(10), big.NewInt(int64(p.D1)), nil))
+	price = big.NewFloat(0)
+	amt0f = (&big.Float{}).SetInt(p.amt0)
+	amt1f = (&big.Float{}).SetInt(p.amt1)
+	amt0f.Quo(amt0f, exp0)
+	amt1f.Quo(amt1f, exp1)
+	if p.priced() == true {
+		if p.B {
+			price.Quo(amt0f, amt1f)
+		} else {
+			price.Quo(amt1f, amt0f)
+		}
+	}
+	return
+}
+
+// whether the last event has a price: something was traded for something, so neither amount is zero.
+// single-sided liquidity (an out-of-range v3 position, a one-coin curve deposit) has none.
+func (p *Pair) priced() bool {
+	return p.mode != 4 && p.amt0.Sign() != 0 && p.amt1.Sign() != 0
+}
+
+// the spot price implied by the reserves, in the same direction as the price from amts()
+func (p *Pair) spot() (price *big.Float, ok bool) {
+	if p.Type == "v3" {
+		if p.sqrtP == nil || p.sqrtP.Sign() == 0 {
+			return
+		}
+		price = sqrt_price(p.sqrtP, p.D0, p.D1)
+		if p.B {
+			price.Quo(big.NewFloat(1), price)
+		}
+		return price, true
+	}
+	if p.r0 == nil || p.r1 == nil || p.r0.Sign() == 0 || p.r1.Sign() == 0 {
+		return
+	}
+	exp0 := (&big.Float{}).SetInt((&big.Int{}).Exp(big.NewInt(10), big.NewInt(int64(p.D0)), nil))
+	exp1 := (&big.Float{}).SetInt((&big.Int{}).Exp(big.NewInt(10), big.NewInt(int64(p.D1)), nil))
+	r0f := (&big.Float{}).SetInt(p.r0)
+	r1f := (&big.Float{}).SetInt(p.r1)
+	r0f.Quo(r0f, exp0)
+	r1f.Quo(r1f, exp1)
+	if p.Stable {
+		x, _ := r0f.Float64()
+		y, _ := r1f.Float64()
+		price = big.NewFloat(stable_price(x, y))
+		if p.B {
+			price.Quo(big.NewFloat(1), price)
+		}
+		return price, true
+	}
+	if p.B {
+		price = r0f.Quo(r0f, r1f)
+	} else {
+		price = r1f.Quo(r1f, r0f)
+	}
+	return price, true
+}
+
+// the marginal price of x in y on the x^3y + y^3x = k curve of solidly stable pairs (reserves renormalized using the decimals)
+func stable_price(x float64, y float64) float64 {
+	return (3*x*x*y + y*y*y) / (x*x*x + 3*x*y*y)
+}
+
+// how much y a fee-less swap of in x pays out on the x^3y + y^3x = k curve, found with newton's method like the pair contract does
+func stable_out(x float64, y float64, in float64) float64 {
+	k := x*x*x*y + y*y*y*x
+	x1 := x + in
+	y1 := y
+	for i := 0; i < 255; i++ {
+		f := x1*x1*x1*y1 + y1*y1*y1*x1 - k
+		step := f / (x1*x1*x1 + 3*y1*y1*x1)
+		y1 -= step
+		if math.Abs(step) <= 1e-12*y {
+			break
+		}
+	}
+	return y - y1
+}
+
+// the price impact and the effective fee of the last swap, both in percent. ok is false for anything but a swap, or when the reserves are unknown.
+// impact compares the execution price with the spot price before the swap (fee included),
+// fee compares the amount paid out with what a fee-less swap on the pool's curve would have paid out.
+func (p *Pair) impact() (impact float64, fee float64, ok bool) {
+	if p.Type == "v3" {
+		return p.v3Impact()
+	}
+	if p.mode > 1 || p.r0 == nil || p.r1 == nil {
+		return
+	}
+	// the reserves before the swap: the Sync event right before it already includes the swap
+	pre0 := new(big.Int).Set(p.r0)
+	pre1 := new(big.Int).Set(p.r1)
+	var in, out, rin, rout *big.Int
+	var din, dout byte
+	if p.mode == 0 {
+		pre0.Sub(pre0, p.amt0)
+		pre1.Add(pre1, p.amt1)
+		in, out, rin, rout = p.amt0, p.amt1, pre0, pre1
+		din, dout = p.D0, p.D1
+	} else {
+		pre0.Add(pre0, p.amt0)
+		pre1.Sub(pre1, p.amt1)
+		in, out, rin, rout = p.amt1, p.amt0, pre1, pre0
+		din, dout = p.D1, p.D0
+	}
+	if in.Sign() <= 0 || out.Sign() <= 0 || rin.Sign() <= 0 || rout.Sign() <= 0 {
+		return
+	}
+	if p.Stable {
+		// the stable curve mixes reserves of both tokens, so work with renormalized amounts
+		norm := func(n *big.Int, d byte) float64 {
+			f := (&big.Float{}).SetInt(n)
+			f.Quo(f, (&big.Float{}).SetInt((&big.Int{}).Exp(big.NewInt(10), big.NewInt(int64(d)), nil)))
+			tmp, _ := f.Float64()
+			return tmp
+		}
+		x, y, inf, outf := norm(rin, din), norm(rout, dout), norm(in, din), norm(out, dout)
+		impact = (1 - (outf/inf)/stable_price(x, y)) * 100
+		fee = (1 - outf/stable_out(x, y, inf)) * 100
+		return impact, fee, true
+	}
+	inf, outf := new(big.Float).SetInt(in), new(big.Float).SetInt(out)
+	rinf, routf := new(big.Float).SetInt(rin), new(big.Float).SetInt(rout)
+	// received per paid, against the pre-trade rate
+	exec := new(big.Float).Quo(outf, inf)
+	mid := new(big.Float).Quo(routf, rinf)
+	ratio, _ := exec.Quo(exec, mid).Float64()
+	impact = (1 - ratio) * 100
+	// without a fee, x*y=k pays out in*rout/(rin+in)
+	ideal := new(big.Float).Mul(inf, routf)
+	ideal.Quo(ideal, new(big.Float).Add(rinf, inf))
+	ratio, _ = new(big.Float).Quo(outf, ideal).Float64()
+	fee = (1 - ratio) * 100
+	return impact, fee, true
+}
+
+// impact() for v3 pools: the pre-trade price is the sqrtPriceX96 before the swap and the fee is the pool's fee tier
+func (p *Pair) v3Impact() (impact float64, fee float64, ok bool) {
+	if p.mode > 1 || p.prev_sqrtP == nil || p.prev_sqrtP.Sign() == 0 || p.amt0.Sign() <= 0 || p.amt1.Sign() <= 0 {
+		return
+	}
+	// the raw price of token0 in token1 before the swap
+	mid := sqrt_price(p.prev_sqrtP, 0, 0)
+	exec := new(big.Float).Quo(new(big.Float).SetInt(p.amt1), new(big.Float).SetInt(p.amt0))
+	var ratio float64
+	if p.mode == 0 {
+		// token0 in, token1 out: received exec token1 per token0
+		ratio, _ = exec.Quo(exec, mid).Float64()
+	} else {
+		// token1 in, token0 out: received 1/exec token0 per token1
+		ratio, _ = mid.Quo(mid, exec).Float64()
+	}
+	return (1 - ratio) * 100, float64(p.Fee) / 1e4, true
+}
+
+// prints a pair, returns the string and the color.
+func (p *Pair) String(d int) (s string, c *color.Color) {
+	amt0f, amt1f, price := p.amts()
+	var t1, t2, t3, t4 string
+	my_red := color.New(color.FgHiRed)
+	my_green := color.New(color.FgGreen)
+	my_cyan := color.New(color.FgCyan)
+	my_yellow := color.New(color.FgYellow)
+	my_blue := color.New(color.FgBlue)
+	my_hiyellow := color.New(color.FgHiYellow)
+
+	switch {
+	case p.mode == 0:
+		t1 = fmt.Sprintf("%12.4f %-*s  ->", amt0f, d+1, p.S0)
+		t2 = fmt.Sprintf("->%12.4f %-*s", amt1f, d, p.S1)
+		if p.B == true {
+			c = my_green
+		} else {
+			c = my_red
+		}
+	case p.mode == 1:
+		t1 = fmt.Sprintf("%12.4f %-*s  ->", amt1f, d+1, p.S1)
+		t2 = fmt.Sprintf("->%12.4f %-*s", amt0f, d, p.S0)
+		c = my_red
+		if p.B == true {
+			c = my_red
+		} else {
+			c = my_green
+		}
+	case p.mode == 2:
+		t1 = fmt.Sprintf("%12.4f %-*s  ->", amt0f, d+1, p.S0)
+		t2 = fmt.Sprintf("<-%12.4f %-*s", amt1f, d, p.S1)
+		c = my_cyan
+	case p.mode == 3:
+		t1 = fmt.Sprintf("%12.4f %-*s  <-", amt0f, d+1, p.S0)
+		t2 = fmt.Sprintf("->%12.4f %-*s", amt1f, d, p.S1)
+		c = my_yellow
+	case p.mode == 5:
+		t1 = fmt.Sprintf("%12.4f %-*s  <=", amt0f, d+1, p.S0)
+		t2 = fmt.Sprintf("=>%12.4f %-*s", amt1f, d, p.S1)
+		c = my_hiyellow
+	case p.mode == 4:
+		t1 = fmt.Sprintf("%+12.4f %-*s  ~>", amt0f, d+1, p.S0)
+		t2 = fmt.Sprintf("~>%+12.4f %-*s", amt1f, d, p.S1)
+		c = my_blue
+	}
+	for k, amt := range p.extra {
+		if 2+k < len(p.Coins) {
+			f := (&big.Float{}).SetInt(amt)
+			f.Quo(f, (&big.Float{}).SetInt((&big.Int{}).Exp(big.NewInt(10), big.NewInt(int64(p.Coins[2+k].D)), nil)))
+			t2 += fmt.Sprintf(" + %.4f %s", f, p.Coins[2+k].S)
+		}
+	}
+	t3 = fmt.Sprintf("%9.4f", price)
+	if p.priced() == false {
+		// there is no price when nothing was traded for anything
+		t3 = fmt.Sprintf("%9s", "-")
+	}
+	if spot, ok := p.spot(); ok == true {
+		t3 += fmt.Sprintf(" %9.4f", spot)
+	} else {
+		t3 += fmt.Sprintf(" %9s", "-")
+	}
+	if impact, fee, ok := p.impact(); ok == true {
+		t4 = fmt.Sprintf("%7.2f%% %5.2f%%", impact, fee)
+	} else {
+		t4 = fmt.Sprintf("%8s %6s", "", "")
+	}
+	s = fmt.Sprintf("%s %s | %s | %s", t1, t2, t3, t4)
+	return
+}
+
+// the names of the modes of a pair, as used by Event.Type
+var mode_names = [...]string{"buy", "sell", "make", "break", "flash", "collect"}
+
+// a decoded event of a pair, as printed by every output format. amounts are raw integers and decimal strings normalised by
+// the token decimals, so that nothing is lost to float rounding.
+type Event struct {
+	Chain   int64     `json:"chainId"`
+	Block   uint64    `json:"block"`
+	Index   uint      `json:"logIndex"`
+	LP      string    `json:"lp"`
+	Tx      string    `json:"tx"`
+	Type    string    `json:"type"`
+	Symbol0 string    `json:"symbol0"`
+	Symbol1 string    `json:"symbol1"`
+	Token0  string    `json:"token0,omitempty"`
+	Token1  string    `json:"token1,omitempty"`
+	Raw0    string    `json:"amount0Raw"`
+	Raw1    string    `json:"amount1Raw"`
+	Amount0 string    `json:"amount0"`
+	Amount1 string    `json:"amount1"`
+	Price   *float64  `json:"price,omitempty"`
+	Spot    *float64  `json:"spot,omitempty"`
+	Impact  *float64  `json:"impact,omitempty"`
+	Fee     *float64  `json:"fee,omitempty"`
+	Extra   []Amount  `json:"extra,omitempty"`
+	Time    time.Time `json:"time"`
+	Removed bool      `json:"removed,omitempty"`
+	// from the header of the block: its time, how many seconds later the event was received, the base fee (in wei,
+	// empty before london) and the miner. missing when the header could not be fetched.
+	BlockTime *time.Time `json:"blockTime,omitempty"`
+	Lag       *float64   `json:"lag,omitempty"`
+	BaseFee   string     `json:"baseFee,omitempty"`
+	Miner     string     `json:"miner,omitempty"`
+}
+
+// adds the data of the header of the event's block, with the block time in loc
+func (e *Event) annotate(head *types.Header, loc *time.Location) {
+	block_time := time.Unix(int64(head.Time), 0).In(loc)
+	lag := e.Time.Sub(block_time).Seconds()
+	e.BlockTime, e.Lag = &block_time, &lag
+	if head.BaseFee != nil {
+		e.BaseFee = head.BaseFee.String()
+	}
+	e.Miner = head.Coinbase.String()
+}
+
+// the amount of one of the other coins of a curve liquidity event
+type Amount struct {
+	Symbol string `json:"symbol"`
+	Token  string `json:"token,omitempty"`
+	Raw    string `json:"amountRaw"`
+	Amount string `json:"amount"`
+}
+
+// decodes the event the pair was last updated with. addr is the pool, received is when the log came in.
+func (p *Pair) event(addr common.Address, vLog types.Log, received time.Time) (e Event) {
+	e = Event{
+		Chain:   p.Chain,
+		Block:   vLog.BlockNumber,
+		Index:   vLog.Index,
+		LP:      addr.String(),
+		Tx:      vLog.TxHash.Hex(),
+		Symbol0: p.S0,
+		Symbol1: p.S1,
+		Token0:  p.T0,
+		Token1:  p.T1,
+		Raw0:    p.amt0.String(),
+		Raw1:    p.amt1.String(),
+		Amount0: decimal_string(p.amt0, p.D0),
+		Amount1: decimal_string(p.amt1, p.D1),
+		Time:    received,
+	}
+	if int(p.mode) < len(mode_names) {
+		e.Type = mode_names[p.mode]
+	}
+	if p.priced() == true {
+		_, _, price := p.amts()
+		f, _ := price.Float64()
+		e.Price = &f
+	}
+	if spot, ok := p.spot(); ok == true {
+		f, _ := spot.Float64()
+		e.Spot = &f
+	}
+	if impact, fee, ok := p.impact(); ok == true {
+		e.Impact, e.Fee = &impact, &fee
+	}
+	for k, amt := range p.extra {
+		if 2+k < len(p.Coins) {
+			coin := p.Coins[2+k]
+			e.Extra = append(e.Extra, Amount{coin.S, coin.Addr, amt.String(), decimal_string(amt, coin.D)})
+		}
+	}
+	return
+}
+
+// formats a raw token amount with d decimals exactly, e.g. 1500000 with 6 decimals is "1.5"
+func decimal_string(amt *big.Int, d byte) string {
+	digits := new(big.Int).Abs(amt).String()
+	if len(digits) <= int(d) {
+		digits = strings.Repeat("0", int(d)-len(digits)+1) + digits
+	}
+	whole, frac := digits[:len(digits)-int(d)], strings.TrimRight(digits[len(digits)-int(d):], "0")
+	if frac != "" {
+		whole += "." + frac
+	}
+	if amt.Sign() < 0 {
+		whole = "-" + whole
+	}
+	return whole
+}
+
+// the following three functions update the pair variable "p" based on the data in the Log Event. Will switch the mode of p depending on the event.
+func (p *Pair) swapUpdate(f []interface{}) {
+	var ell [4]*big.Int
+	for i, k := range f {
+		ell[i] = k.(*big.Int)
+	}
+	// amount0In amount1In amount0Out amount1Out. flash swaps, fee-on-transfer tokens and some routers
+	// report both ins (or both outs) as non-zero, so only the net flow into the pool is meaningful.
+	net0 := new(big.Int).Sub(ell[0], ell[2])
+	net1 := new(big.Int).Sub(ell[1], ell[3])
+	p.flowUpdate(net0, net1)
+}
+
+// sets the amounts and the mode from the net flow of each token into the pool
+func (p *Pair) flowUpdate(net0 *big.Int, net1 *big.Int) {
+	switch {
+	case net0.Sign() > 0 && net1.Sign() < 0:
+		// BUY
+		p.amt0 = net0
+		p.amt1 = new(big.Int).Neg(net1)
+		p.mode = 0
+	case net0.Sign() < 0 && net1.Sign() > 0:
+		// SELL
+		p.amt0 = new(big.Int).Neg(net0)
+		p.amt1 = net1
+		p.mode = 1
+	default:
+		// FLASH/COMPLEX: both tokens moved the same way (or not at all), e.g. a flash swap repaid with a fee
+		p.amt0 = net0
+		p.amt1 = net1
+		p.mode = 4
+	}
+}
+func (p *Pair) mintUpdate(f []interface{}) {
+	var ell [2]*big.Int
+	for i, k := range f {
+		ell[i] = k.(*big.Int)
+	}
+	p.amt0 = ell[0]
+	p.amt1 = ell[1]
+	p.mode = 2
+}
+
+// updates a curve pool from one of its events and returns the pair to print, if any.
+// exchanges are printed as a swap between the two coins involved, liquidity events as make/break rows over every coin.
+func (p *Pair) curveUpdate(name string, f []interface{}) (v *Pair) {
+	if len(p.Coins) < 2 {
+		return
+	}
+	p.extra = nil
+	switch name {
+	case "TokenExchange", "TokenExchangeUnderlying":
+		coins := p.Coins
+		if name == "TokenExchangeUnderlying" && len(p.Underlying) > 0 {
+			coins = p.Underlying
+		}
+		i, k := f[0].(*big.Int), f[2].(*big.Int)
+		if !i.IsInt64() || !k.IsInt64() || i.Int64() < 0 || k.Int64() < 0 || i.Int64() >= int64(len(coins)) || k.Int64() >= int64(len(coins)) {
+			return
+		}
+		p.amt0 = f[1].(*big.Int)
+		p.amt1 = f[3].(*big.Int)
+		p.mode = 0
+		view := p.coin_view(coins[i.Int64()], coins[k.Int64()])
+		return &view
+	case "AddLiquidity", "RemoveLiquidity", "RemoveLiquidityImbalance":
+		amounts := big_ints(f[0])
+		if len(amounts) < 2 {
+			return
+		}
+		p.amt0, p.amt1, p.extra = amounts[0], amounts[1], amounts[2:]
+		if p.mode = 3; name == "AddLiquidity" {
+			p.mode = 2
+		}
+		return p
+	case "RemoveLiquidityOne":
+		// the event doesn't say which coin was withdrawn. show the LP tokens burned, and the amount
+		// received only when every coin has the same decimals.
+		p.amt0 = f[0].(*big.Int)
+		p.amt1 = big.NewInt(0)
+		p.mode = 3
+		view := p.coin_view(Coin{S: "LP", D: 18}, Coin{S: "?", D: p.Coins[0].D})
+		for _, coin := range p.Coins {
+			if coin.D != p.Coins[0].D {
+				return &view
+			}
+		}
+		view.amt1 = f[1].(*big.Int)
+		return &view
+	}
+	return
+}
+
+// updates a balancer pool from a vault Swap and returns the pair to print. tokenIn and tokenOut are the 3rd and 4th topics.
+func (p *Pair) balancerUpdate(topics []common.Hash, f []interface{}) (v *Pair) {
+	if len(topics) < 4 {
+		return
+	}
+	in, out := -1, -1
+	for i, coin := range p.Coins {
+		switch common.HexToAddress(coin.Addr) {
+		case common.BytesToAddress(topics[2].Bytes()):
+			in = i
+		case common.BytesToAddress(topics[3].Bytes()):
+			out = i
+		}
+	}
+	if in < 0 || out < 0 {
+		return
+	}
+	p.amt0 = f[0].(*big.Int)
+	p.amt1 = f[1].(*big.Int)
+	p.mode = 0
+	view := p.coin_view(p.Coins[in], p.Coins[out])
+	return &view
+}
+
+// a copy of the pair which shows c0 and c1 in place of its first two coins
+func (p *Pair) coin_view(c0 Coin, c1 Coin) Pair {
+	v := *p
+	v.S0, v.D0, v.T0 = c0.S, c0.D, c0.Addr
+	v.S1, v.D1, v.T1 = c1.S, c1.D, c1.Addr
+	v.extra = nil
+	return v
+}
+
+// turns an unpacked uint256[N] into a slice
+func big_ints(arr interface{}) (ell []*big.Int) {
+	v := reflect.ValueOf(arr)
+	if v.Kind() != reflect.Array && v.Kind() != reflect.Slice {
+		return
+	}
+	for i := 0; i < v.Len(); i++ {
+		if tmp, ok := v.Index(i).Interface().(*big.Int); ok == true {
+			ell = append(ell, tmp)
+		}
+	}
+	return
+}
+
+// v3 swaps carry signed amounts (positive into the pool) along with the new price and liquidity
+func (p *Pair) v3SwapUpdate(f []interface{}) {
+	p.prev_sqrtP = p.sqrtP
+	p.sqrtP = f[2].(*big.Int)
+	p.liq = f[3].(*big.Int)
+	p.flowUpdate(f[0].(*big.Int), f[1].(*big.Int))
+}
+func (p *Pair) collectUpdate(f []interface{}) {
+	p.amt0 = f[0].(*big.Int)
+	p.amt1 = f[1].(*big.Int)
+	p.mode = 5
+}
+func (p *Pair) syncUpdate(f []interface{}) {
+	p.r0 = f[0].(*big.Int)
+	p.r1 = f[1].(*big.Int)
+}
+func (p *Pair) burnUpdate(f []interface{}) {
+	var ell [2]*big.Int
+	for i, k := range f {
+		ell[i] = k.(*big.Int)
+	}
+	p.amt0 = ell[0]
+	p.amt1 = ell[1]
+	p.mode = 3
+}
+
+// uses ethCall() to get the current reserves of an LP
+func fetch_reserves(lp_addr string, eps *chain_endpoints) (r0 *big.Int, r1 *big.Int, err error) {
+	tmpabi, _ := abi.JSON(strings.NewReader(`[{"inputs":[],"name":"getReserves","outputs":[{"internalType":"uint112","name":"_reserve0","type":"uint112"},{"internalType":"uint112","name":"_reserve1","type":"uint112"},{"internalType":"uint32","name":"_blockTimestampLast","type":"uint32"}],"stateMutability":"view","type":"function"}]`))
+	packed_bytes, _ := tmpabi.Pack("getReserves")
+	result, err := eps.ethCall(lp_addr, fmt.Sprintf("%#x", packed_bytes))
+	if err != nil {
+		return
+	}
+	body, err := hexutil.Decode(result)
+	if err != nil {
+		return
+	}
+	f, err := tmpabi.Unpack("getReserves", body)
+	if err != nil {
+		return
+	}
+	return f[0].(*big.Int), f[1].(*big.Int), nil
+}
+
+// uses ethCall() to get the current price of a v3 pool
+func fetch_slot0(lp_addr string, eps *chain_endpoints) (sqrtP *big.Int, err error) {
+	tmpabi, _ := abi.JSON(strings.NewReader(v3_abi))
+	packed_bytes, _ := tmpabi.Pack("slot0")
+	result, err := eps.ethCall(lp_addr, fmt.Sprintf("%#x", packed_bytes))
+	if err != nil {
+		return
+	}
+	body, err := hexutil.Decode(result)
+	if err != nil {
+		return
+	}
+	f, err := tmpabi.Unpack("slot0", body)
+	if err != nil {
+		return
+	}
+	return f[0].(*big.Int), nil
+}
+
+// fetches what the bootstrap needs to know about an LP in a single multicall: a v3 pool has slot0 (and a fee tier),
+// a v2 pair has token0 and token1 (and stable() when it is a solidly pair). err tells why token0 or token1 could not be
+// fetched... part of bootstrap
+func fetch_lp(lp_addr string, eps *chain_endpoints) (typ string, fee uint32, tokens []string, stable bool, err error) {
+	v3abi, _ := abi.JSON(strings.NewReader(v3_abi))
+	tmpabi, _ := abi.JSON(strings.NewReader(`[{"inputs":[],"name":"token0","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"token1","outputs":[{"internalType":"address","name":"","type":"address"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"stable","outputs":[{"internalType":"bool","name":"","type":"bool"}],"stateMutability":"view","type":"function"}]`))
+	var calls []eth_call
+	for _, method := range []string{"slot0", "fee"} {
+		packed_bytes, _ := v3abi.Pack(method)
+		calls = append(calls, eth_call{lp_addr, packed_bytes})
+	}
+	for _, method := range []string{"token0", "token1", "stable"} {
+		packed_bytes, _ := tmpabi.Pack(method)
+		calls = append(calls, eth_call{lp_addr, packed_bytes})
+	}
+	results, errs := eps.multicall(calls)
+	for i, method := range []string{"token0", "token1"} {
+		if f, ok := unpack_call(tmpabi, method, results[2+i]); ok == true {
+			tokens = append(tokens, f[0].(common.Address).String())
+		} else if err == nil {
+			err = errs[2+i]
+		}
+	}
+	if f, ok := unpack_call(tmpabi, "stable", results[4]); ok == true {
+		stable = f[0].(bool)
+	}
+	if _, ok := unpack_call(v3abi, "slot0", results[0]); ok == true {
+		if f, ok := unpack_call(v3abi, "fee", results[1]); ok == true {
+			fee = uint32(f[0].(*big.Int).Uint64())
+		}
+		return "v3", fee, tokens, false, err
+	}
+	return "v2", 0, tokens, stable, err
+}
+
+// unpacks the return data of a call to method. ok is false when the call failed or returned something else.
+func unpack_call(tmpabi abi.ABI, method string, data []byte) (f []interface{}, ok bool) {
+	if data == nil {
+		return
+	}
+	f, err := tmpabi.Unpack(method, data)
+	return f, err == nil && len(f) > 0
+}
+
+// uses ethCall() to get the number of pairs created by a factory
+func fetch_pairs_length(factory string, eps *chain_endpoints) (n uint64, err error) {
+	tmpabi, _ := abi.JSON(strings.NewReader(factory_abi))
+	packed_bytes, _ := tmpabi.Pack("allPairsLength")
+	result, err := eps.ethCall(factory, fmt.Sprintf("%#x", packed_bytes))
+	if err != nil {
+		return
+	}
+	body, err := hexutil.Decode(result)
+	if err != nil {
+		return
+	}
+	f, err := tmpabi.Unpack("allPairsLength", body)
+	if err != nil {
+		return
+	}
+	return f[0].(*big.Int).Uint64(), nil
+}
+
+// gets the pairs from..to-1 created by a factory, batched through multicall. pairs that could not be read are left out,
+// and returned in failed (as "allPairs(i)") along with why.
+func fetch_all_pairs(factory string, from uint64, to uint64, eps *chain_endpoints) (addrs []common.Address, failed map[string]error) {
+	tmpabi, _ := abi.JSON(strings.NewReader(factory_abi))
+	var calls []eth_call
+	for i := from; i < to; i++ {
+		packed_bytes, _ := tmpabi.Pack("allPairs", new(big.Int).SetUint64(i))
+		calls = append(calls, eth_call{factory, packed_bytes})
+	}
+	results, errs := eps.multicall(calls)
+	failed = make(map[string]error)
+	for i, result := range results {
+		if f, ok := unpack_call(tmpabi, "allPairs", result); ok == true {
+			addrs = append(addrs, f[0].(common.Address))
+		} else if errs[i] != nil {
+			failed[fmt.Sprintf("allPairs(%d)", from+uint64(i))] = errs[i]
+		} else {
+			failed[fmt.Sprintf("allPairs(%d)", from+uint64(i))] = fmt.Errorf("could not decode the pair address")
+		}
+	}
+	return
+}
+
+// the address curve pools use for the native coin of the chain
+const native_coin = "0xEeeeeEeeeEeEeeEeEeEeeEEEeeeeEeeeeeeeEEeE"
+
+// fetches every coin of a curve pool along with its symbol and decimals. method is "coins" or "underlying_coins".
+// older pools take an int128 index, newer ones a uint256, so both are tried in the same multicall... part of bootstrap
+func fetch_coins(lp_addr string, method string, tokens *chain_tokens, symbols map[common.Address]string, decimals map[common.Address]byte, eps *chain_endpoints) (coins []Coin, err error) {
+	tmpabi, _ := abi.JSON(strings.NewReader(fmt.Sprintf(`[{"inputs":[{"name":"i","type":"uint256"}],"name":"%[1]s","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"},{"inputs":[{"name":"i","type":"int128"}],"name":"%[1]s","outputs":[{"name":"","type":"address"}],"stateMutability":"view","type":"function"}]`, method)))
+	// curve pools hold at most 8 coins
+	var calls []eth_call
+	for i := int64(0); i < 8; i++ {
+		for _, name := range []string{method, method + "0"} {
+			packed_bytes, _ := tmpabi.Pack(name, big.NewInt(i))
+			calls = append(calls, eth_call{lp_addr, packed_bytes})
+		}
+	}
+	// a failed call is the end of the coins
+	results, _ := eps.multicall(calls)
+	var addrs []string
+	for i := 0; i < 8; i++ {
+		f, ok := unpack_call(tmpabi, method, results[2*i])
+		if !ok {
+			f, ok = unpack_call(tmpabi, method+"0", results[2*i+1])
+		}
+		if !ok {
+			break
+		}
+		addrs = append(addrs, f[0].(common.Address).String())
+	}
+	return fetch_coin_metadata(addrs, tokens, symbols, decimals, eps)
+}
+
+// fetches the symbol and decimals of every coin missing from tokens in a single multicall, and adds them to tokens... part of bootstrap
+// tokens without a usable symbol() are named after their name(), unless symbols overrides the symbol of the token.
+// tokens without decimals() can only be used when decimals overrides them.
+// every coin is returned even when some could not be resolved, err then lists what went wrong with each of them.
+func fetch_coin_metadata(addrs []string, tokens *chain_tokens, symbols map[common.Address]string, decimals map[common.Address]byte, eps *chain_endpoints) (coins []Coin, err error) {
+	tmpabi, _ := abi.JSON(strings.NewReader(`[{"inputs":[],"name":"symbol","outputs":[{"internalType":"string","name":"","type":"string"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"name","outputs":[{"internalType":"string","name":"","type":"string"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"decimals","outputs":[{"internalType":"uint8","name":"","type":"uint8"}],"stateMutability":"view","type":"function"}]`))
+	methods := []string{"symbol", "name", "decimals"}
+	var missing []string
+	for _, addr := range addrs {
+		if strings.EqualFold(addr, native_coin) {
+			tokens.set(addr, Token{S: eps.name, D: 18})
+		} else if _, ok := tokens.get(addr); !ok {
+			missing = append(missing, addr)
+		}
+	}
+	var calls []eth_call
+	for _, addr := range missing {
+		for _, method := range methods {
+			packed_bytes, _ := tmpabi.Pack(method)
+			calls = append(calls, eth_call{addr, packed_bytes})
+		}
+	}
+	results, errs := eps.multicall(calls)
+	var problems []string
+	for i, addr := range missing {
+		symbol, name, dec := results[len(methods)*i], results[len(methods)*i+1], results[len(methods)*i+2]
+		// why symbol() and decimals() failed, if they did
+		because := func(err error) string {
+			if err == nil {
+				return ""
+			}
+			return fmt.Sprintf(" (%v)", err)
+		}
+		t := Token{S: decode_text(tmpabi, "symbol", symbol)}
+		if t.S == "" {
+			t.S = decode_text(tmpabi, "name", name)
+		}
+		_, overridden := symbols[common.HexToAddress(addr)]
+		ok := true
+		if t.S == "" && !overridden {
+			problems = append(problems, fmt.Sprintf("%s has no symbol() or name()%s", addr, because(errs[len(methods)*i])))
+			ok = false
+		}
+		if f, found := unpack_call(tmpabi, "decimals", dec); found == true {
+			t.D = f[0].(byte)
+		} else if d, overridden := decimals[common.HexToAddress(addr)]; overridden == true {
+			t.D = d
+		} else {
+			problems = append(problems, fmt.Sprintf("%s has no decimals()%s, set them in the chain's \"decimals\"", addr, because(errs[len(methods)*i+2])))
+			ok = false
+		}
+		if ok {
+			tokens.set(addr, t)
+		}
+	}
+	for _, addr := range addrs {
+		coin := Coin{Addr: addr, S: "ERROR", D: 18}
+		if t, ok := tokens.get(addr); ok == true {
+			coin.S, coin.D = t.S, t.D
+		}
+		if s, ok := symbols[common.HexToAddress(addr)]; ok == true {
+			coin.S = s
+		}
+		if d, ok := decimals[common.HexToAddress(addr)]; ok == true {
+			coin.D = d
+		}
+		coins = append(coins, coin)
+	}
+	if len(problems) > 0 {
+		err = fmt.Errorf("%s", strings.Join(problems, ", "))
+	}
+	return
+}
+
+// decodes the return data of symbol() or name(): a string on most tokens, but a bytes32 on some older ones (e.g. MKR).
+// characters which would break the output are dropped. returns "" when there is nothing usable.
+func decode_text(tmpabi abi.ABI, method string, data []byte) (s string) {
+	if f, ok := unpack_call(tmpabi, method, data); ok == true {
+		s = f[0].(string)
+	} else if len(data) == 32 {
+		s = string(bytes.TrimRight(data, "\x00"))
+	}
+	s = strings.Map(func(r rune) rune {
+		if !unicode.IsPrint(r) || unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+	return
+}
+
+// the symbol and decimals overrides of a chain, by token address. read from the "symbols" and "decimals" entries of the chain header.
+func token_overrides(head *ChainConfig) (symbols map[common.Address]string, decimals map[common.Address]byte) {
+	symbols = make(map[common.Address]string)
+	for addr, s := range head.Symbols {
+		symbols[common.HexToAddress(addr)] = s
+	}
+	decimals = make(map[common.Address]byte)
+	for addr, d := range head.Decimals {
+		decimals[common.HexToAddress(addr)] = d
+	}
+	return
+}
+
+// sets the symbols and decimals of the tokens of the pair which have an override
+func (p *Pair) override(symbols map[common.Address]string, decimals map[common.Address]byte) {
+	set := func(addr string, s *string, d *byte) {
+		if addr == "" {
+			return
+		}
+		if tmp, ok := symbols[common.HexToAddress(addr)]; ok == true {
+			*s = tmp
+		}
+		if tmp, ok := decimals[common.HexToAddress(addr)]; ok == true {
+			*d = tmp
+		}
+	}
+	set(p.T0, &p.S0, &p.D0)
+	set(p.T1, &p.S1, &p.D1)
+	for _, list := range [][]Coin{p.Coins, p.Underlying} {
+		for i := range list {
+			set(list[i].Addr, &list[i].S, &list[i].D)
+		}
+	}
+}
+
+// uses ethCall() to get the tokens of a balancer pool from its vault... part of bootstrap
+func fetch_pool_tokens(vault string, pool_id string, eps *chain_endpoints) (addrs []string, err error) {
+	tmpabi, _ := abi.JSON(strings.NewReader(vault_abi))
+	packed_bytes, _ := tmpabi.Pack("getPoolTokens", common.HexToHash(pool_id))
+	result, err := eps.ethCall(vault, fmt.Sprintf("%#x", packed_bytes))
+	if err != nil {
+		return
+	}
+	body, err := hexutil.Decode(result)
+	if err != nil {
+		return
+	}
+	f, err := tmpabi.Unpack("getPoolTokens", body)
+	if err != nil {
+		return
+	}
+	for _, tmp := range f[0].([]common.Address) {
+		addrs = append(addrs, tmp.String())
+	}
+	return
+}
+
+// fetches the reserves (v2) or price (v3) of every listened pair at once and stores them in ram
+func load_pool_state(ram map[common.Address]Pair, addresses map[int64][]common.Address, chains map[int64]*chain_endpoints) {
+	type result struct {
+		addr   common.Address
+		r0, r1 *big.Int
+		sqrtP  *big.Int
+		err    error
+	}
+	results := make(chan result)
+	var n int
+	for key, val := range addresses {
+		for _, addr := range val {
+			if p := ram[addr]; p.pool_type() != "v2" && p.pool_type() != "v3" {
+				// curve and balancer pools have no single reserve price
+				continue
+			}
+			n++
+			go func(addr common.Address, typ string, eps *chain_endpoints) {
+				r := result{addr: addr}
+				if typ == "v3" {
+					r.sqrtP, r.err = fetch_slot0(addr.String(), eps)
+				} else {
+					r.r0, r.r1, r.err = fetch_reserves(addr.String(), eps)
+				}
+				results <- r
+			}(addr, ram[addr].Type, chains[key])
+		}
+	}
+	for i := 0; i < n; i++ {
+		r := <-results
+		if r.err != nil {
+			fmt.Fprintf(os.Stderr, "could not fetch the state of %s (%v)\n", r.addr.String(), r.err)
+			continue
+		}
+		p := ram[r.addr]
+		p.r0, p.r1, p.sqrtP = r.r0, r.r1, r.sqrtP
+		ram[r.addr] = p
+	}
+}
+
+// loads ram from ram file. ram files in the untyped format of version 1 are migrated to the current version,
+// and the original is kept next to it with a .v1 extension.
+func load_ram_from_ram_file(filename string) (header map[int64]*ChainConfig, ram map[common.Address]Pair, err error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	var file RamFile
+	migrated := false
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		if file, err = migrate_ram_file(b); err != nil {
+			return nil, nil, fmt.Errorf("could not migrate %s (%v)", filename, err)
+		}
+		migrated = true
+	} else if err = json.Unmarshal(b, &file); err != nil {
+		return nil, nil, fmt.Errorf("could not read %s (%v)", filename, err)
+	}
+	if err = file.validate(); err != nil {
+		return nil, nil, fmt.Errorf("%s is invalid:%v", filename, err)
+	}
+	header, ram = file.Chains, file.Pairs
+	// the symbols and decimals of the pairs are kept in the token registry
+	registry, err := load_token_file(token_file(filename))
+	if err != nil {
+		return
+	}
+	if err = registry.fill(ram); err != nil {
+		return nil, nil, fmt.Errorf("%s does not match %s:%v", filename, token_file(filename), err)
+	}
+	if migrated {
+		if err = os.WriteFile(filename+".v1", b, 0644); err != nil {
+			return
+		}
+		if err = save_ram_to_ram_file(header, ram, nil, filename); err != nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "migrated %s to version %d, the original is in %s.v1\n", filename, ram_file_version, filename)
+	}
+	// the symbols and decimals set in the header win over the registry, so an override takes effect without a new bootstrap.
+	// they are only applied in memory, the registry keeps the fetched tokens.
+	for key, p := range ram {
+		p.override(token_overrides(header[p.Chain]))
+		ram[key] = p
+	}
+	return
+}
+
+// reads a ram file in the untyped format of version 1: a [header, ram] array
+func migrate_ram_file(b []byte) (file RamFile, err error) {
+	var j [2]json.RawMessage
+	if err = json.Unmarshal(b, &j); err != nil {
+		return
+	}
+	if err = json.Unmarshal(j[0], &file.Chains); err != nil {
+		return
+	}
+	if err = json.Unmarshal(j[1], &file.Pairs); err != nil {
+		return
+	}
+	file.Version = ram_file_version
+	return
+}
+
+// saves ram to a ram file, and the tokens of its pairs to the token registry next to it. the symbols and decimals of
+// the pairs may have been overridden by the header, so the tokens already in the registry are kept as they are, and
+// new tokens are taken from fetched (the registry they were fetched into, may be nil) before the pairs.
+func save_ram_to_ram_file(header map[int64]*ChainConfig, ram map[common.Address]Pair, fetched token_registry, filename string) (err error) {
+	registry, err := load_token_file(token_file(filename))
+	if err != nil {
+		return
+	}
+	registry.merge(fetched)
+	registry.add(ram)
+	if err = registry.save(token_file(filename)); err != nil {
+		return
+	}
+	f, err := os.Create(filename)
+	defer f.Close()
+	if err != nil {
+		return
+	}
+	stripped := make(map[common.Address]Pair)
+	for key, val := range ram {
+		stripped[key] = val.without_tokens()
+	}
+	r := json.NewEncoder(f)
+	r.SetIndent("", "  ")
+	err = r.Encode(RamFile{Version: ram_file_version, Chains: header, Pairs: stripped})
+	return
+}
+
+// the version of the ram file written by the listener. version 1 is the untyped [header, ram] array.
+const ram_file_version = 2
+
+// RamFile is the content of the ram file: the settings of every chain, and every pair by LP address
+type RamFile struct {
+	Version int                     `json:"version"`
+	Chains  map[int64]*ChainConfig  `json:"chains"`
+	Pairs   map[common.Address]Pair `json:"pairs"`
+}
+
+// ChainConfig holds the settings of a single chain, in the ram file and in the bootstrap file
+type ChainConfig struct {
+	Name string `json:"name"`
+	// the http and websocket endpoints of the chain
+	URL Endpoints `json:"url"`
+	WSS Endpoints `json:"wss"`
+	// how often to poll chains without a wss endpoint, e.g. "3s"
+	Poll string `json:"poll,omitempty"`
+	// how many blocks the head must be past an event before it is printed
+	Confirmations uint64 `json:"confirmations,omitempty"`
+	// the address of the balancer vault, needed for balancer pools
+	Vault string `json:"vault,omitempty"`
+	// the address of a uniswap v2-style factory, used by -discover and -watch_factories
+	Factory string `json:"factory,omitempty"`
+	// symbols to use instead of the ones fetched from the blockchain, by token address
+	Symbols map[string]string `json:"symbols,omitempty"`
+	// decimals to use instead of the ones fetched from the blockchain (e.g. for tokens without decimals()), by token address
+	Decimals map[string]byte `json:"decimals,omitempty"`
+	// bootstrap file only: the LP addresses (or balancer pool ids) to fetch
+	Data []string `json:"data,omitempty"`
+}
+
+// Endpoints is a single endpoint or a list of them. it is written as a plain string when there is at most one.
+type Endpoints []string
+
+func (e *Endpoints) UnmarshalJSON(b []byte) (err error) {
+	var s string
+	if err = json.Unmarshal(b, &s); err == nil {
+		*e = Endpoints{}
+		if s != "" {
+			*e = Endpoints{s}
+		}
+		return
+	}
+	var list []string
+	if err = json.Unmarshal(b, &list); err != nil {
+		return fmt.Errorf("expected an endpoint or a list of endpoints, got %s", b)
+	}
+	*e = list
+	return
+}
+
+func (e Endpoints) MarshalJSON() ([]byte, error) {
+	switch len(e) {
+	case 0:
+		return json.Marshal("")
+	case 1:
+		return json.Marshal(e[0])
+	}
+	return json.Marshal([]string(e))
+}
+
+// checks the settings of chain id and returns what is wrong with them. bootstrap also checks the data list.
+func (c *ChainConfig) validate(id int64, bootstrap bool) (problems []string) {
+	where := fmt.Sprintf("chain %d", id)
+	if c.Name == "" {
+		problems = append(problems, where+": missing name")
+	} else {
+		where = fmt.Sprintf("chain %d (%s)", id, c.Name)
+	}
+	var urls int
+	for _, url := range c.URL {
+		if url == "" {
+			continue
+		}
+		urls++
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			problems = append(problems, fmt.Sprintf("%s: bad url %q, expected http:// or https://", where, url))
+		}
+	}
+	if urls == 0 {
+		problems = append(problems, where+": missing url")
+	}
+	for _, url := range c.WSS {
+		if url != "" && !strings.HasPrefix(url, "ws://") && !strings.HasPrefix(url, "wss://") {
+			problems = append(problems, fmt.Sprintf("%s: bad wss %q, expected ws:// or wss://", where, url))
+		}
+	}
+	if c.Poll != "" {
+		if d, err := time.ParseDuration(c.Poll); err != nil || d <= 0 {
+			problems = append(problems, fmt.Sprintf("%s: bad poll interval %q, expected e.g. \"3s\"", where, c.Poll))
+		}
+	}
+	if c.Vault != "" && !common.IsHexAddress(c.Vault) {
+		problems = append(problems, fmt.Sprintf("%s: bad vault address %q", where, c.Vault))
+	}
+	if c.Factory != "" && !common.IsHexAddress(c.Factory) {
+		problems = append(problems, fmt.Sprintf("%s: bad factory address %q", where, c.Factory))
+	}
+	for addr := range c.Symbols {
+		if !common.IsHexAddress(addr) {
+			problems = append(problems, fmt.Sprintf("%s: bad token address %q in symbols", where, addr))
+		}
+	}
+	for addr := range c.Decimals {
+		if !common.IsHexAddress(addr) {
+			problems = append(problems, fmt.Sprintf("%s: bad token address %q in decimals", where, addr))
+		}
+	}
+	if bootstrap {
+		for _, entry := range c.Data {
+			if !common.IsHexAddress(entry) && !is_pool_id(entry) {
+				problems = append(problems, fmt.Sprintf("%s: bad entry %q in data, expected an LP address or a balancer pool id", where, entry))
+			}
+		}
+	}
+	return
+}
+
+// returns true for the 0x-prefixed 32 byte id of a balancer pool
+func is_pool_id(s string) bool {
+	b, err := hexutil.Decode(s)
+	return err == nil && len(b) == common.HashLength
+}
+
+// checks the whole ram file, so a bad entry is reported when the file is loaded instead of panicking while listening
+func (f *RamFile) validate() error {
+	var problems []string
+	if f.Version > ram_file_version {
+		problems = append(problems, fmt.Sprintf("version %d was written by a newer listener, this one reads up to version %d", f.Version, ram_file_version))
+	}
+	if len(f.Chains) == 0 {
+		problems = append(problems, "no chains")
+	}
+	for id, c := range f.Chains {
+		if c == nil {
+			problems = append(problems, fmt.Sprintf("chain %d: missing settings", id))
+			continue
+		}
+		problems = append(problems, c.validate(id, false)...)
+	}
+	for addr, p := range f.Pairs {
+		where := fmt.Sprintf("pair %s", addr.String())
+		if _, ok := f.Chains[p.Chain]; ok == false {
+			problems = append(problems, fmt.Sprintf("%s: unknown chain %d", where, p.Chain))
+		}
+		for _, t := range []string{p.T0, p.T1} {
+			if t != "" && !common.IsHexAddress(t) {
+				problems = append(problems, fmt.Sprintf("%s: bad token address %q", where, t))
+			}
+		}
+		switch p.Type {
+		case "", "v2", "v3", "curve":
+		case "balancer":
+			if !is_pool_id(p.PoolID) {
+				problems = append(problems, fmt.Sprintf("%s: bad balancer pool id %q", where, p.PoolID))
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("%s: unknown type %q", where, p.Type))
+		}
+	}
+	return problem_list(problems)
+}
+
+// turns a list of problems into a single error, one problem per line. nil when there are none.
+func problem_list(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("\n  %s", strings.Join(problems, "\n  "))
+}
+
+// the symbol and decimals of a token, as kept in the token registry
+type Token struct {
+	S string `json:"symbol"`
+	D byte   `json:"decimals"`
+}
+
+// the tokens of a single chain by address. safe to use from several goroutines.
+type chain_tokens struct {
+	mu     sync.Mutex
+	tokens map[common.Address]Token
+}
+
+func (c *chain_tokens) get(addr string) (t Token, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok = c.tokens[common.HexToAddress(addr)]
+	return
+}
+
+func (c *chain_tokens) set(addr string, t Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tokens[common.HexToAddress(addr)] = t
+}
+
+// the token registry: the tokens of every chain, shared by all the pairs of the chain so a token is only fetched (and fixed) once
+type token_registry map[int64]*chain_tokens
+
+// returns the tokens of a chain, creating them if needed. not safe to call from several goroutines.
+func (r token_registry) chain(id int64) *chain_tokens {
+	if _, ok := r[id]; ok == false {
+		r[id] = &chain_tokens{tokens: make(map[common.Address]Token)}
+	}
+	return r[id]
+}
+
+// the token registry is kept next to the ram file
+func token_file(ram_filename string) string {
+	return filepath.Join(filepath.Dir(ram_filename), "tokens.data")
+}
+
+// loads the token registry. a missing file is an empty registry.
+func load_token_file(filename string) (registry token_registry, err error) {
+	registry = make(token_registry)
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return registry, nil
+	} else if err != nil {
+		return
+	}
+	defer f.Close()
+	var j map[int64]map[common.Address]Token
+	if err = json.NewDecoder(f).Decode(&j); err != nil {
+		return
+	}
+	for key, val := range j {
+		registry.chain(key).tokens = val
+	}
+	return
+}
+
+// saves the token registry
+func (r token_registry) save(filename string) (err error) {
+	j := make(map[int64]map[common.Address]Token)
+	for key, val := range r {
+		j[key] = val.tokens
+	}
+	f, err := os.Create(filename)
+	defer f.Close()
+	if err != nil {
+		return
+	}
+	w := json.NewEncoder(f)
+	w.SetIndent("", "  ")
+	err = w.Encode(j)
+	return
+}
+
+// builds a token registry from the tokens of the pairs in ram
+func registry_of(ram map[common.Address]Pair) token_registry {
+	registry := make(token_registry)
+	registry.add(ram)
+	return registry
+}
+
+// adds the tokens of the pairs in ram which aren't in the registry yet
+func (r token_registry) add(ram map[common.Address]Pair) {
+	for _, p := range ram {
+		tokens := r.chain(p.Chain)
+		for _, c := range p.coins() {
+			if _, ok := tokens.get(c.Addr); ok == false && c.Addr != "" {
+				tokens.set(c.Addr, Token{S: c.S, D: c.D})
+			}
+		}
+	}
+}
+
+// adds the tokens of other which aren't in the registry yet
+func (r token_registry) merge(other token_registry) {
+	for key, val := range other {
+		tokens := r.chain(key)
+		val.mu.Lock()
+		for addr, t := range val.tokens {
+			if _, ok := tokens.tokens[addr]; ok == false {
+				tokens.tokens[addr] = t
+			}
+		}
+		val.mu.Unlock()
+	}
+}
+
+// sets the symbols and decimals of the pairs in ram from the registry. a token which was left to the registry
+// (it has an address but no symbol in ram) and isn't in it is a problem, the pair would be shown with 0 decimals.
+func (r token_registry) fill(ram map[common.Address]Pair) error {
+	var problems []string
+	for key, p := range ram {
+		tokens := r.chain(p.Chain)
+		missing := func(addr string) {
+			problems = append(problems, fmt.Sprintf("pair %s: token %s is missing", key.String(), addr))
+		}
+		if t, ok := tokens.get(p.T0); ok == true && p.T0 != "" {
+			p.S0, p.D0 = t.S, t.D
+		} else if p.T0 != "" && p.S0 == "" {
+			missing(p.T0)
+		}
+		if t, ok := tokens.get(p.T1); ok == true && p.T1 != "" {
+			p.S1, p.D1 = t.S, t.D
+		} else if p.T1 != "" && p.S1 == "" {
+			missing(p.T1)
+		}
+		for _, list := range [][]Coin{p.Coins, p.Underlying} {
+			for i := range list {
+				if t, ok := tokens.get(list[i].Addr); ok == true {
+					list[i].S, list[i].D = t.S, t.D
+				} else if list[i].Addr != "" && list[i].S == "" {
+					missing(list[i].Addr)
+				}
+			}
+		}
+		ram[key] = p
+	}
+	return problem_list(problems)
+}
+
+// every token of the pair along with its address: token0 and token1, and the coins of curve and balancer pools
+func (p *Pair) coins() (coins []Coin) {
+	coins = append(coins, Coin{Addr: p.T0, S: p.S0, D: p.D0}, Coin{Addr: p.T1, S: p.S1, D: p.D1})
+	coins = append(coins, p.Coins...)
+	return append(coins, p.Underlying...)
+}
+
+// the pair as saved in the ram file: the symbols and decimals of the tokens with an address are left to the token registry
+func (p Pair) without_tokens() Pair {
+	if p.T0 != "" {
+		p.S0, p.D0 = "", 0
+	}
+	if p.T1 != "" {
+		p.S1, p.D1 = "", 0
+	}
+	strip := func(list []Coin) (out []Coin) {
+		for _, c := range list {
+			out = append(out, Coin{Addr: c.Addr})
+		}
+		return
+	}
+	p.Coins, p.Underlying = strip(p.Coins), strip(p.Underlying)
+	return p
+}
+
+// the entry for a pair in the bootstrap file: the LP address, or the poolId for balancer pools
+func (p *Pair) bootstrap_entry(addr common.Address) string {
+	if p.Type == "balancer" {
+		return p.PoolID
+	}
+	return addr.String()
+}
+
+// uses ram file to create a bootstrap file
+func save_bootstrap_file(header map[int64]*ChainConfig, ram map[common.Address]Pair, filename string) (err error) {
+	f, err := os.Create(filename)
+	defer f.Close()
+	if err != nil {
+		return
+	}
+	r := json.NewEncoder(f)
+	r.SetIndent("", "  ")
+	bootstrap := make(map[int64]*ChainConfig)
+	for key, val := range ram {
+		if try, ok := bootstrap[val.Chain]; ok == false {
+			// the bootstrap header is the ram header plus the data list
+			tmp := *header[val.Chain]
+			tmp.Data = []string{val.bootstrap_entry(key)}
+			bootstrap[val.Chain] = &tmp
+		} else {
+			try.Data = append(try.Data, val.bootstrap_entry(key))
+		}
+	}
+	err = r.Encode(bootstrap)
+	return
+}
+
+// loads the bootstrap file by calling the blockchain to get the symbol and decimal metadata.
+// the tokens already in registry are not fetched again.
+func load_bootstrap_file(filename string, registry token_registry) (ram_header map[int64]*ChainConfig, ram map[common.Address]Pair, err error) {
+	bootstrap := make(map[int64]*ChainConfig)
+	if f, ok := os.Open(filename); ok != nil {
 		f.Close()
 		err = ok
 		return
-	} else {
-		defer f.Close()
-		r := json.NewDecoder(f)
-		j := make(map[int64]interface{})
-		err = r.Decode(&j)
-		if err != nil {
+	} else {
+		defer f.Close()
+		r := json.NewDecoder(f)
+		j := make(map[int64]*ChainConfig)
+		err = r.Decode(&j)
+		if err != nil {
+			return
+		}
+		bootstrap = j
+	}
+	var problems []string
+	for key, val := range bootstrap {
+		if val == nil {
+			problems = append(problems, fmt.Sprintf("chain %d: missing settings", key))
+			continue
+		}
+		problems = append(problems, val.validate(key, true)...)
+	}
+	if err = problem_list(problems); err != nil {
+		return nil, nil, fmt.Errorf("%s is invalid:%v", filename, err)
+	}
+
+	ram_header = make(map[int64]*ChainConfig)
+	ram = make(map[common.Address]Pair)
+	for key, val := range bootstrap {
+		// the ram header is the bootstrap header without the data list
+		header := *val
+		header.Data = nil
+		ram_header[key] = &header
+		eps := new_chain_endpoints(key, &header)
+		eps.check()
+		fmt.Print(eps.summary())
+		if err = eps.verify(); err != nil {
+			return nil, nil, err
+		}
+		pairs, failed := fetch_pairs(val.Data, key, &header, registry.chain(key), eps)
+		for addr, p := range pairs {
+			ram[addr] = p
+		}
+		print_failed(eps.name, failed)
+	}
+	return
+}
+
+// fetches the metadata of a single bootstrap entry (an LP address, or the poolId of a balancer pool) from the blockchain
+// and returns the pair along with the address it is kept under in ram. tokens already in tokens are not fetched again... part of bootstrap
+func fetch_pair(entry string, chain int64, head *ChainConfig, tokens *chain_tokens, eps *chain_endpoints) (addr common.Address, p Pair, err error) {
+	p = Pair{Chain: chain, B: true}
+	symbols, decimals := token_overrides(head)
+	if is_pool_id(entry) {
+		// a 32 byte entry is the poolId of a balancer pool, whose first 20 bytes are the pool address
+		vault := head.Vault
+		addrs, err := fetch_pool_tokens(vault, entry, eps)
+		if err != nil {
+			return addr, p, fmt.Errorf("could not fetch the tokens of the balancer pool from the vault %q (%v)", vault, err)
+		} else if len(addrs) < 2 {
+			return addr, p, fmt.Errorf("could not fetch the tokens of the balancer pool from the vault %q", vault)
+		}
+		p.Type, p.PoolID = "balancer", entry
+		if p.Coins, err = fetch_coin_metadata(addrs, tokens, symbols, decimals, eps); err != nil {
+			return addr, p, err
+		}
+		p.T0, p.T1 = p.Coins[0].Addr, p.Coins[1].Addr
+		p.S0, p.D0 = p.Coins[0].S, p.Coins[0].D
+		p.S1, p.D1 = p.Coins[1].S, p.Coins[1].D
+		return common.HexToAddress(entry[:2+2*common.AddressLength]), p, nil
+	}
+	addr = common.HexToAddress(entry)
+	typ, fee, lp_tokens, stable, lp_err := fetch_lp(entry, eps)
+	if typ == "v2" && len(lp_tokens) == 0 {
+		// neither a v3 pool nor a v2 pair, so it may be a curve pool
+		if coins, err := fetch_coins(entry, "coins", tokens, symbols, decimals, eps); len(coins) >= 2 {
+			if err != nil {
+				return addr, p, err
+			}
+			p.Type, p.Coins = "curve", coins
+			if p.Underlying, err = fetch_coins(entry, "underlying_coins", tokens, symbols, decimals, eps); err != nil {
+				return addr, p, err
+			}
+			p.T0, p.T1 = p.Coins[0].Addr, p.Coins[1].Addr
+			p.S0, p.D0 = p.Coins[0].S, p.Coins[0].D
+			p.S1, p.D1 = p.Coins[1].S, p.Coins[1].D
+			return addr, p, nil
+		}
+	}
+	if len(lp_tokens) < 2 {
+		if lp_err != nil {
+			return addr, p, fmt.Errorf("could not fetch token0 and token1 (%v)", lp_err)
+		}
+		return addr, p, fmt.Errorf("could not fetch token0 and token1")
+	}
+	coins, err := fetch_coin_metadata(lp_tokens, tokens, symbols, decimals, eps)
+	if err != nil {
+		return
+	}
+	p.T0, p.T1 = coins[0].Addr, coins[1].Addr
+	p.S0, p.D0 = coins[0].S, coins[0].D
+	p.S1, p.D1 = coins[1].S, coins[1].D
+	if p.Type, p.Fee = typ, fee; p.Type == "v2" {
+		p.Type = ""
+		p.Stable = stable
+	}
+	return
+}
+
+// how many bootstrap entries are fetched at the same time on each chain
+const bootstrap_workers = 8
+
+// fetches every entry of a chain with fetch_pair, bootstrap_workers at a time, and shows a progress bar meanwhile.
+// the entries that could not be fetched are returned in failed, along with the reason... part of bootstrap
+func fetch_pairs(entries []string, chain int64, head *ChainConfig, tokens *chain_tokens, eps *chain_endpoints) (pairs map[common.Address]Pair, failed map[string]error) {
+	type result struct {
+		entry string
+		addr  common.Address
+		pair  Pair
+		err   error
+	}
+	jobs, results := make(chan string), make(chan result)
+	for i := 0; i < bootstrap_workers; i++ {
+		go func() {
+			for entry := range jobs {
+				addr, p, err := fetch_pair(entry, chain, head, tokens, eps)
+				results <- result{entry, addr, p, err}
+			}
+		}()
+	}
+	go func() {
+		for _, entry := range entries {
+			jobs <- entry
+		}
+		close(jobs)
+	}()
+	pairs, failed = make(map[common.Address]Pair), make(map[string]error)
+	for i := range entries {
+		r := <-results
+		if r.err != nil {
+			failed[r.entry] = r.err
+		} else {
+			pairs[r.addr] = r.pair
+		}
+		progress(eps.name, i+1, len(entries))
+	}
+	if len(entries) > 0 {
+		fmt.Println()
+	}
+	return
+}
+
+// the width of the progress bar shown while bootstrapping
+const progress_width = 30
+
+// draws the progress bar of a chain over the current line
+func progress(name string, done int, total int) {
+	n := progress_width * done / total
+	fmt.Printf("\rfetching %s pairs [%s%s] %d/%d", name, strings.Repeat("#", n), strings.Repeat(".", progress_width-n), done, total)
+}
+
+// lists the entries of a chain that could not be fetched, and why
+func print_failed(name string, failed map[string]error) {
+	if len(failed) == 0 {
+		return
+	}
+	entries := make([]string, 0, len(failed))
+	for entry := range failed {
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	fmt.Printf("%d %s pairs could not be fetched:\n", len(entries), name)
+	for _, entry := range entries {
+		fmt.Printf("  %s (%v)\n", entry, failed[entry])
+	}
+}
+
+// the most blocks an endpoint may trail the best head seen on its chain and still count as healthy
+const max_head_lag = 5
+
+// how long a single endpoint health check may take
+const health_timeout = 5 * time.Second
+
+// how often the endpoints of a listened chain are checked again, so that a websocket connected to an endpoint which
+// falls behind moves to a better one
+const health_interval = 1 * time.Minute
+
+// endpoint is a single rpc url along with the result of its last health check
+type endpoint struct {
+	url     string
+	latency time.Duration
+	head    uint64
+	lag     uint64
+	err     error
+	checked bool
+	// the chain the endpoint serves according to eth_chainId (or net_version), 0 when it didn't say
+	served uint64
+	// set when served is not the chain the endpoint is configured for
+	wrong_chain bool
+}
+
+func (e *endpoint) healthy() bool {
+	return e.err == nil && e.lag <= max_head_lag && !e.wrong_chain
+}
+
+// chain_endpoints holds every http and wss endpoint configured for a chain, ordered best first.
+// the "url" and "wss" header entries may each be a single endpoint or a list of them.
+type chain_endpoints struct {
+	id           int64 // the chain id the endpoints are configured for
+	name         string
+	mu           sync.Mutex
+	http         []*endpoint
+	wss          []*endpoint
+	no_multicall bool // set once a multicall fails on the chain, see aggregate()
+}
+
+// the endpoints of chain id from its header. empty endpoints are skipped.
+func new_chain_endpoints(id int64, head *ChainConfig) *chain_endpoints {
+	c := &chain_endpoints{id: id, name: head.Name}
+	for _, url := range head.URL {
+		if url != "" {
+			c.http = append(c.http, &endpoint{url: url})
+		}
+	}
+	for _, url := range head.WSS {
+		if url != "" {
+			c.wss = append(c.wss, &endpoint{url: url})
+		}
+	}
+	return c
+}
+
+// measures the latency, head and chain id of every endpoint, then sorts them best first:
+// healthy endpoints before unhealthy ones, then by head lag, then by latency.
+// endpoints serving another chain are never healthy, see verify().
+func (c *chain_endpoints) check() {
+	c.mu.Lock()
+	all := append(append([]*endpoint{}, c.http...), c.wss...)
+	c.mu.Unlock()
+	results := make([]probe, len(all))
+	var wg sync.WaitGroup
+	for i, e := range all {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			results[i] = measure_endpoint(url)
+		}(i, e.url)
+	}
+	wg.Wait()
+	var best uint64
+	for _, r := range results {
+		if r.err == nil && !r.wrong_chain(c.id) && r.head > best {
+			best = r.head
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, e := range all {
+		e.latency, e.head, e.err, e.checked = results[i].latency, results[i].head, results[i].err, true
+		e.served, e.wrong_chain = results[i].served(), results[i].wrong_chain(c.id)
+		e.lag = 0
+		if e.err == nil && !e.wrong_chain && e.head < best {
+			e.lag = best - e.head
+		}
+	}
+	sort_endpoints(c.http)
+	sort_endpoints(c.wss)
+}
+
+// checks the endpoints every health_interval, for as long as the chain is listened to
+func (c *chain_endpoints) monitor() {
+	for range time.Tick(health_interval) {
+		c.check()
+	}
+}
+
+// returns the head lag of the wss endpoint url, and true when it lags by more than max_head_lag while the best wss
+// endpoint is another, healthy one
+func (c *chain_endpoints) lagging(url string) (lag uint64, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.wss) == 0 || c.wss[0].url == url || !c.wss[0].healthy() {
+		return
+	}
+	for _, e := range c.wss {
+		if e.url == url {
+			return e.lag, e.err == nil && e.lag > max_head_lag
+		}
+	}
+	return
+}
+
+func sort_endpoints(list []*endpoint) {
+	sort.SliceStable(list, func(i, k int) bool {
+		a, b := list[i], list[k]
+		if a.healthy() != b.healthy() {
+			return a.healthy()
+		}
+		if a.lag != b.lag {
+			return a.lag < b.lag
+		}
+		return a.latency < b.latency
+	})
+}
+
+// the result of a single endpoint health check
+type probe struct {
+	latency     time.Duration
+	head        uint64
+	chain_id    uint64 // from eth_chainId, 0 when the endpoint doesn't support it
+	net_version uint64 // from net_version, 0 when the endpoint doesn't support it
+	err         error
+}
+
+// the chain the endpoint says it serves. eth_chainId is preferred, since net_version differs from it on a few chains.
+func (r probe) served() uint64 {
+	if r.chain_id != 0 {
+		return r.chain_id
+	}
+	return r.net_version
+}
+
+// returns true when the endpoint said which chain it serves, and it isn't id
+func (r probe) wrong_chain(id int64) bool {
+	return r.served() != 0 && r.served() != uint64(id)
+}
+
+// dials url (http or wss), asks for the current block, then for the chain it serves with eth_chainId and net_version
+func measure_endpoint(url string) (r probe) {
+	ctx, cancel := context.WithTimeout(context.Background(), health_timeout)
+	defer cancel()
+	start := time.Now()
+	client, err := ethclient.DialContext(ctx, url)
+	if err != nil {
+		r.err = err
+		return
+	}
+	defer client.Close()
+	if r.head, r.err = client.BlockNumber(ctx); r.err != nil {
+		return
+	}
+	r.latency = time.Since(start)
+	if id, err := client.ChainID(ctx); err == nil {
+		r.chain_id = id.Uint64()
+	}
+	if id, err := client.NetworkID(ctx); err == nil {
+		r.net_version = id.Uint64()
+	}
+	return
+}
+
+// checks every chain at once and prints the startup summary.
+// returns an error if any endpoint serves another chain than the one it is configured for.
+func check_all(chains map[int64]*chain_endpoints) error {
+	var wg sync.WaitGroup
+	for _, c := range chains {
+		wg.Add(1)
+		go func(c *chain_endpoints) {
+			defer wg.Done()
+			c.check()
+		}(c)
+	}
+	wg.Wait()
+	var problems []string
+	for _, c := range chains {
+		fmt.Fprint(os.Stderr, c.summary())
+		if err := c.verify(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problem_list(problems)
+}
+
+// returns an error listing the endpoints of the chain which serve another chain, so a copy-pasted url can't
+// label the swaps of one chain as another's. endpoints which didn't answer can't be verified and are let through.
+func (c *chain_endpoints) verify() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var wrong []string
+	for _, e := range append(append([]*endpoint{}, c.wss...), c.http...) {
+		if e.wrong_chain {
+			wrong = append(wrong, fmt.Sprintf("%s serves chain %d", e.url, e.served))
+		}
+	}
+	if len(wrong) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s is chain %d, but %s", c.name, c.id, strings.Join(wrong, ", "))
+}
+
+// a table of the endpoints of the chain, best first
+func (c *chain_endpoints) summary() (s string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s = fmt.Sprintf("%-6s %-8s %-48s %8s %10s %4s  %s\n", "chain", "id", "endpoint", "latency", "head", "lag", "status")
+	for _, e := range append(append([]*endpoint{}, c.wss...), c.http...) {
+		status := "ok"
+		served := "?"
+		if e.served != 0 {
+			served = fmt.Sprint(e.served)
+		}
+		switch {
+		case !e.checked:
+			status = "unchecked"
+		case e.err != nil:
+			status = fmt.Sprintf("down (%v)", e.err)
+		case e.wrong_chain:
+			status = fmt.Sprintf("wrong chain (expected %d)", c.id)
+		case !e.healthy():
+			status = "lagging"
+		case e.served == 0:
+			status = "ok (chain id not verified)"
+		}
+		s += fmt.Sprintf("%-6s %-8s %-48s %6dms %10d %4d  %s\n", c.name, served, e.url, e.latency.Milliseconds(), e.head, e.lag, status)
+	}
+	return
+}
+
+// the best wss endpoint, or "" if the chain has none
+func (c *chain_endpoints) best_wss() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.wss) == 0 {
+		return ""
+	}
+	return c.wss[0].url
+}
+
+// the best http endpoint, or "" if the chain has none
+func (c *chain_endpoints) best_http() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.http) == 0 {
+		return ""
+	}
+	return c.http[0].url
+}
+
+// the http endpoints, best first. a copy, so requests can fail over through them while endpoints are demoted.
+func (c *chain_endpoints) http_urls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	urls := make([]string, len(c.http))
+	for i, e := range c.http {
+		urls[i] = e.url
+	}
+	return urls
+}
+
+// moves a failing endpoint behind every other endpoint of its kind
+func (c *chain_endpoints) demote(url string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, list := range [][]*endpoint{c.http, c.wss} {
+		for i, e := range list {
+			if e.url == url {
+				copy(list[i:], list[i+1:])
+				list[len(list)-1] = e
+				break
+			}
+		}
+	}
+}
+
+// calls ethCall on the best http endpoint, failing over to the next one whenever a request fails.
+// a revert is returned straight away, as every endpoint would return it. other json-rpc errors (e.g. a rate limit, or
+// a node lagging behind) are the endpoint's own, so they fail over like any other failed request.
+func (c *chain_endpoints) ethCall(addr string, data string) (result_string string, err error) {
+	urls := c.http_urls()
+	err = fmt.Errorf("no http endpoint for %s blockchain", c.name)
+	for _, url := range urls {
+		if result_string, err = ethCall(url, addr, data); err == nil {
 			return
 		}
-		bootstrap = j
+		if e, ok := err.(*json_error); ok == true && e.reverted() {
+			return
+		}
+		c.demote(url)
 	}
+	return
+}
 
-	ram_header = make(map[int64]interface{})
-	ram = make(map[common.Address]Pair)
-	for key, val := range bootstrap {
-		header := make(map[string]string)
-		var data []interface{}
-		var url string
-		if try, ok := val.(map[string]interface{}); ok == true {
-			data = try["data"].([]interface{})
-			header["wss"] = try["wss"].(string)
-			url = try["url"].(string)
-			header["url"] = url
-			header["name"] = try["name"].(string)
-		}
-		ram_header[key] = header
-		for _, lpaddr_i := range data {
-			lpaddr := lpaddr_i.(string)
-			t0c, t1c, s0c, s1c, d0c, d1c := make(chan string), make(chan string), make(chan string), make(chan string), make(chan byte), make(chan byte)
-			go fetch_tokens(lpaddr, t0c, t1c, url)
-			go fetch_symbol(<-t0c, s0c, url)
-			go fetch_symbol(<-t1c, s1c, url)
-			go fetch_decimals(<-t0c, d0c, url)
-			go fetch_decimals(<-t1c, d1c, url)
-			p := Pair{}
-			p.S0 = <-s0c
-			p.S1 = <-s1c
-			p.D0 = <-d0c
-			p.D1 = <-d1c
-			p.Chain = key
-			p.B = true
-			ram[common.HexToAddress(lpaddr)] = p
-		}
-	}
-	return
-}
-
-// ethCall is used to make a one-off json request to the blockchain
-func ethCall(url string, addr string, data string) (result_string string) {
-	result_string, _ = func() (str string, ok bool) {
-		var myRequest json_request
-		tmp1 := make(map[string]string)
-		tmp1["to"] = addr
-		tmp1["data"] = data
-		tmpParams := []interface{}{tmp1, "latest"}
-		myRequest = json_request{ID: time.Now().Add(69*time.Hour + 420*time.Nanosecond).Unix(), Method: "eth_call", JSONRPC: "2.0", Params: tmpParams}
-		body, err := make_json_request(myRequest, url)
-		if err != nil {
+// fetches the header of the block with the given hash from the best http endpoint, failing over to the next one whenever a request fails
+func (c *chain_endpoints) header_by_hash(hash common.Hash) (head *chain_header, err error) {
+	urls := c.http_urls()
+	err = fmt.Errorf("no http endpoint for %s blockchain", c.name)
+	for _, url := range urls {
+		if err = rpcCall(url, "eth_getBlockByHash", []interface{}{hash, false}, &head); err == nil && head == nil {
+			// the node doesn't know the block (yet), which another node may
+			err = fmt.Errorf("block %s not found", hash.Hex())
+		}
+		if err == nil {
 			return
 		}
-		var tmp json_response
-		json.Unmarshal(body, &tmp)
-		str, ok = tmp.Result.(string)
+		c.demote(url)
+	}
+	return
+}
+
+// the most block headers kept per chain
+const header_cache_size = 1024
+
+// a block header along with its hash as given by the node. types.Header.Hash() can't be used instead, it hashes
+// only the fields this version of go-ethereum knows about, which misses e.g. the withdrawalsRoot of newer blocks.
+type chain_header struct {
+	head *types.Header
+	hash common.Hash
+}
+
+func (h *chain_header) UnmarshalJSON(input []byte) error {
+	var tmp struct {
+		Hash common.Hash `json:"hash"`
+	}
+	if err := json.Unmarshal(input, &tmp); err != nil {
+		return err
+	}
+	h.head = new(types.Header)
+	h.hash = tmp.Hash
+	return h.head.UnmarshalJSON(input)
+}
+
+// header_cache is a least recently used cache of the block headers of a chain, which the events are annotated with.
+// it is filled with the new heads of the websocket listeners, and the listener of each chain fetches the headers
+// missing from it (e.g. on polled chains) before it forwards the logs, so annotating an event never holds up the
+// handler and costs at most one header request per block rather than one per event.
+// headers are looked up by number and hash, so an event is never annotated with a block which was dropped by a reorg.
+type header_cache struct {
+	eps     *chain_endpoints
+	mu      sync.Mutex
+	headers map[uint64]*list.Element // the element of each cached block number in recent
+	recent  *list.List               // the cached *chain_header, most recently used first
+}
+
+func new_header_cache(eps *chain_endpoints) *header_cache {
+	return &header_cache{eps: eps, headers: make(map[uint64]*list.Element), recent: list.New()}
+}
+
+// the header of block n if it is cached. a cached header with another hash belongs to a block which was replaced
+// (or is about to be) by a reorg, and doesn't count.
+func (h *header_cache) peek(n uint64, hash common.Hash) (*types.Header, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	el, ok := h.headers[n]
+	if ok == false || el.Value.(*chain_header).hash != hash {
+		return nil, false
+	}
+	h.recent.MoveToFront(el)
+	return el.Value.(*chain_header).head, true
+}
+
+// fetches the headers of the blocks of logs which aren't cached yet, once per block. a block which can't be fetched
+// is reported, and its events go without the header.
+func (h *header_cache) fetch(logs []types.Log) {
+	if h == nil {
+		return
+	}
+	done := make(map[common.Hash]bool)
+	for _, vLog := range logs {
+		if done[vLog.BlockHash] {
+			continue
+		}
+		done[vLog.BlockHash] = true
+		if _, ok := h.peek(vLog.BlockNumber, vLog.BlockHash); ok == true {
+			continue
+		}
+		head, err := h.eps.header_by_hash(vLog.BlockHash)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not fetch block %d of %s blockchain (%v)\n", vLog.BlockNumber, h.eps.name, err)
+			continue
+		}
+		h.add(head)
+	}
+}
+
+// caches a header, dropping the least recently used one when the cache is full. a header replaces the cached one
+// of the same number, e.g. after a reorg.
+func (h *header_cache) add(head *chain_header) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	n := head.head.Number.Uint64()
+	if el, ok := h.headers[n]; ok == true {
+		el.Value = head
+		h.recent.MoveToFront(el)
 		return
-	}()
+	}
+	h.headers[n] = h.recent.PushFront(head)
+	if h.recent.Len() > header_cache_size {
+		oldest := h.recent.Back()
+		h.recent.Remove(oldest)
+		delete(h.headers, oldest.Value.(*chain_header).head.Number.Uint64())
+	}
+}
+
+// the Multicall3 contract, deployed at the same address on most chains. the bootstrap batches its calls through it.
+const multicall3 = "0xcA11bde05977b3631167028862bE2a173976CA11"
+
+// the most calls batched in a single multicall, larger batches risk running into the gas limit of eth_call
+const multicall_chunk = 200
+
+// a single call batched in a multicall
+type eth_call struct {
+	to   string
+	data []byte
+}
+
+// makes every call in as few requests as possible by batching them through Multicall3, and returns the return data
+// of each call (nil when the call failed) along with why each failed call failed.
+// chains without Multicall3 fall back to a json-rpc batch of eth_calls.
+func (c *chain_endpoints) multicall(calls []eth_call) (results [][]byte, errs []error) {
+	results = make([][]byte, len(calls))
+	errs = make([]error, len(calls))
+	for start := 0; start < len(calls); start += multicall_chunk {
+		end := start + multicall_chunk
+		if end > len(calls) {
+			end = len(calls)
+		}
+		if !c.aggregate(calls[start:end], results[start:end], errs[start:end]) {
+			c.batch_call(calls[start:end], results[start:end], errs[start:end])
+		}
+	}
+	return
+}
+
+// why a call failed: it reverted (with the reason it gave, if any), or it returned nothing
+func call_error(data []byte, reverted bool) error {
+	if !reverted && len(data) == 0 {
+		return fmt.Errorf("empty result")
+	}
+	if reason, err := abi.UnpackRevert(data); err == nil {
+		return fmt.Errorf("execution reverted: %s", reason)
+	}
+	return fmt.Errorf("execution reverted")
+}
+
+// makes the calls without Multicall3, as a single json-rpc batch of eth_calls, and writes the return data of each into results.
+// the batch fails over to the next endpoint when it fails as a whole. calls which failed on their own are left nil,
+// with the error returned for them in errs.
+func (c *chain_endpoints) batch_call(calls []eth_call, results [][]byte, errs []error) {
+	requests := make([]json_request, len(calls))
+	for i, call := range calls {
+		params := []interface{}{map[string]string{"to": call.to, "data": hexutil.Encode(call.data)}, "latest"}
+		requests[i] = json_request{Method: "eth_call", JSONRPC: "2.0", Params: params}
+	}
+	urls := c.http_urls()
+	for _, url := range urls {
+		responses, err := make_batch_request(requests, url)
+		if err != nil {
+			c.demote(url)
+			continue
+		}
+		for i, r := range responses {
+			if r.Error != nil {
+				errs[i] = r.Error
+				continue
+			}
+			s, _ := r.Result.(string)
+			results[i], errs[i] = decode_result(s)
+		}
+		return
+	}
+	// no endpoint took the batch (some reject batches altogether), so the calls are made one by one
+	for i, call := range calls {
+		result, err := c.ethCall(call.to, hexutil.Encode(call.data))
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		results[i], errs[i] = decode_result(result)
+	}
+}
+
+// decodes the result of an eth_call. an empty result is an error.
+func decode_result(result string) (body []byte, err error) {
+	if body, err = hexutil.Decode(result); err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		return nil, call_error(body, false)
+	}
+	return
+}
+
+// batches calls through Multicall3 and writes the return data of each into results, or why it failed into errs.
+// returns false when the batch could not be made, in which case the calls should be made one by one.
+func (c *chain_endpoints) aggregate(calls []eth_call, results [][]byte, errs []error) bool {
+	c.mu.Lock()
+	skip := c.no_multicall
+	c.mu.Unlock()
+	if skip {
+		return false
+	}
+	type call3 struct {
+		Target       common.Address
+		AllowFailure bool
+		CallData     []byte
+	}
+	type result3 struct {
+		Success    bool
+		ReturnData []byte
+	}
+	tmpabi, _ := abi.JSON(strings.NewReader(multicall_abi))
+	batch := make([]call3, len(calls))
+	for i, call := range calls {
+		batch[i] = call3{common.HexToAddress(call.to), true, call.data}
+	}
+	packed_bytes, err := tmpabi.Pack("aggregate3", batch)
+	if err != nil {
+		return false
+	}
+	result, err := c.ethCall(multicall3, hexutil.Encode(packed_bytes))
+	if err != nil {
+		// every endpoint failed (or the batch as a whole reverted), which says nothing about Multicall3
+		return false
+	}
+	body, err := hexutil.Decode(result)
+	if err == nil {
+		var f []interface{}
+		if f, err = tmpabi.Unpack("aggregate3", body); err == nil {
+			if res := *abi.ConvertType(f[0], new([]result3)).(*[]result3); len(res) == len(calls) {
+				for i, r := range res {
+					if r.Success && len(r.ReturnData) > 0 {
+						results[i] = r.ReturnData
+					} else {
+						errs[i] = call_error(r.ReturnData, !r.Success)
+					}
+				}
+				return true
+			}
+		}
+	}
+	// the chain has no Multicall3, so the later batches go straight to eth_call
+	fmt.Fprintf(os.Stderr, "no multicall on %s blockchain, falling back to batched eth_calls\n", c.name)
+	c.mu.Lock()
+	c.no_multicall = true
+	c.mu.Unlock()
+	return false
+}
+
+// ethCall is used to make a one-off json request to the blockchain.
+// err is set when the request fails, or to the *json_error returned for the call (e.g. a revert).
+func ethCall(url string, addr string, data string) (result_string string, err error) {
+	var myRequest json_request
+	tmp1 := make(map[string]string)
+	tmp1["to"] = addr
+	tmp1["data"] = data
+	tmpParams := []interface{}{tmp1, "latest"}
+	myRequest = json_request{ID: time.Now().Add(69*time.Hour + 420*time.Nanosecond).Unix(), Method: "eth_call", JSONRPC: "2.0", Params: tmpParams}
+	body, err := make_json_request(myRequest, url)
+	if err != nil {
+		return
+	}
+	var tmp json_response
+	if err = json.Unmarshal(body, &tmp); err != nil {
+		return
+	}
+	if tmp.Error != nil {
+		return "", tmp.Error
+	}
+	result_string, ok := tmp.Result.(string)
+	if ok == false {
+		err = fmt.Errorf("eth_call returned no result")
+	}
+	return
+}
+
+// rpcCall makes a single json request and decodes its result into result
+func rpcCall(url string, method string, params interface{}, result interface{}) (err error) {
+	myRequest := json_request{ID: time.Now().UnixNano(), Method: method, JSONRPC: "2.0", Params: params}
+	body, err := make_json_request(myRequest, url)
+	if err != nil {
+		return
+	}
+	var tmp json_response
+	if err = json.Unmarshal(body, &tmp); err != nil {
+		return
+	}
+	if tmp.Error != nil {
+		return tmp.Error
+	}
+	if tmp.Result == nil {
+		return fmt.Errorf("%s returned no result", method)
+	}
+	b, err := json.Marshal(tmp.Result)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, result)
 	return
 }
 
@@ -525,6 +3515,7 @@ type json_response struct {
 	ID      int64       `json:"id"`
 	JSONRPC string      `json:"jsonrpc"`
 	Result  interface{} `json:"result"`
+	Error   *json_error `json:"error,omitempty"`
 }
 type json_request struct {
 	ID      int64       `json:"id"`
@@ -533,30 +3524,137 @@ type json_request struct {
 	Params  interface{} `json:"params"`
 }
 
+// the error object of a json response, e.g. a reverted eth_call or a rate limit
+type json_error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *json_error) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+// whether the error is an execution revert. geth returns code 3 for reverts with data, other nodes only the message.
+func (e *json_error) reverted() bool {
+	return e.Code == 3 || strings.HasPrefix(e.Message, "execution reverted")
+}
+
+// the longest a single json request (or batch) may take, connecting included
+const rpc_timeout = 30 * time.Second
+
+// shared by every json request, so connections to an endpoint are kept alive and reused
+var rpc_client = &http.Client{
+	Timeout: rpc_timeout,
+	Transport: &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 16,
+		IdleConnTimeout:     90 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+}
+
 // low level function for making json request
 func make_json_request(myRequest json_request, url string) (rbody []byte, err error) {
-	var client http.Client
-	body, err := json.Marshal(myRequest)
+	return post_json(myRequest, url)
+}
+
+// sends every request in a single POST and returns the responses in the same order as the requests.
+// the requests are numbered by their position, so their IDs are overwritten. a request the endpoint did not answer
+// gets a response with an error. err is only set when the batch itself fails.
+func make_batch_request(requests []json_request, url string) (responses []json_response, err error) {
+	batch := make([]json_request, len(requests))
+	for i, r := range requests {
+		r.ID = int64(i)
+		batch[i] = r
+	}
+	rbody, err := post_json(batch, url)
+	if err != nil {
+		return
+	}
+	var tmp []json_response
+	if err = json.Unmarshal(rbody, &tmp); err != nil {
+		// endpoints without batch support answer with a single error object
+		var single json_response
+		if json.Unmarshal(rbody, &single) == nil && single.Error != nil {
+			err = single.Error
+		}
+		return
+	}
+	responses = make([]json_response, len(requests))
+	answered := make([]bool, len(requests))
+	for _, r := range tmp {
+		if r.ID >= 0 && r.ID < int64(len(requests)) {
+			responses[r.ID] = r
+			answered[r.ID] = true
+		}
+	}
+	for i := range responses {
+		responses[i].ID = requests[i].ID
+		if !answered[i] {
+			responses[i].Error = &json_error{Code: -1, Message: "no response in batch"}
+		}
+	}
+	return
+}
+
+// POSTs body as json and returns the response body. responses other than 200 OK count as failed requests.
+func post_json(body interface{}, url string) (rbody []byte, err error) {
+	b, err := json.Marshal(body)
 	if err != nil {
 		return
 	}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(b))
 	if err != nil {
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
-	response, err := client.Do(req)
+	response, err := rpc_client.Do(req)
 	if err != nil {
 		return
 	}
+	defer response.Body.Close()
 	rbody, err = io.ReadAll(response.Body)
-	// fmt.Printf("%s\n", rbody)
 	if err != nil {
 		return
 	}
-	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("%s returned %s", url, response.Status)
+	}
 	return
 }
 
 // the ABI for standard LP contract
 const lp_abi = `[{"inputs":[],"payable":false,"stateMutability":"nonpayable","type":"constructor"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"owner","type":"address"},{"indexed":true,"internalType":"address","name":"spender","type":"address"},{"indexed":false,"internalType":"uint256","name":"value","type":"uint256"}],"name":"Approval","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"sender","type":"address"},{"indexed":false,"internalType":"uint256","name":"amount0","type":"uint256"},{"indexed":false,"internalType":"uint256","name":"amount1","type":"uint256"},{"indexed":true,"internalType":"address","name":"to","type":"address"}],"name":"Burn","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"sender","type":"address"},{"indexed":false,"internalType":"uint256","name":"amount0","type":"uint256"},{"indexed":false,"internalType":"uint256","name":"amount1","type":"uint256"}],"name":"Mint","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"sender","type":"address"},{"indexed":false,"internalType":"uint256","name":"amount0In","type":"uint256"},{"indexed":false,"internalType":"uint256","name":"amount1In","type":"uint256"},{"indexed":false,"internalType":"uint256","name":"amount0Out","type":"uint256"},{"indexed":false,"internalType":"uint256","name":"amount1Out","type":"uint256"},{"indexed":true,"internalType":"address","name":"to","type":"address"}],"name":"Swap","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"uint112","name":"reserve0","type":"uint112"},{"indexed":false,"internalType":"uint112","name":"reserve1","type":"uint112"}],"name":"Sync","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"from","type":"address"},{"indexed":true,"internalType":"address","name":"to","type":"address"},{"indexed":false,"internalType":"uint256","name":"value","type":"uint256"}],"name":"Transfer","type":"event"},{"constant":true,"inputs":[],"name":"DOMAIN_SEPARATOR","outputs":[{"internalType":"bytes32","name":"","type":"bytes32"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"MINIMUM_LIQUIDITY","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"PERMIT_TYPEHASH","outputs":[{"internalType":"bytes32","name":"","type":"bytes32"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[{"internalType":"address","name":"","type":"address"},{"internalType":"address","name":"","type":"address"}],"name":"allowance","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":false,"inputs":[{"internalType":"address","name":"spender","type":"address"},{"internalType":"uint256","name":"value","type":"uint256"}],"name":"approve","outputs":[{"internalType":"bool","name":"","type":"bool"}],"payable":false,"stateMutability":"nonpayable","type":"function"},{"constant":true,"inputs":[{"internalType":"address","name":"","type":"address"}],"name":"balanceOf","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":false,"inputs":[{"internalType":"address","name":"to","type":"address"}],"name":"burn","outputs":[{"internalType":"uint256","name":"amount0","type":"uint256"},{"internalType":"uint256","name":"amount1","type":"uint256"}],"payable":false,"stateMutability":"nonpayable","type":"function"},{"constant":true,"inputs":[],"name":"decimals","outputs":[{"internalType":"uint8","name":"","type":"uint8"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"factory","outputs":[{"internalType":"address","name":"","type":"address"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"getReserves","outputs":[{"internalType":"uint112","name":"_reserve0","type":"uint112"},{"internalType":"uint112","name":"_reserve1","type":"uint112"},{"internalType":"uint32","name":"_blockTimestampLast","type":"uint32"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":false,"inputs":[{"internalType":"address","name":"_token0","type":"address"},{"internalType":"address","name":"_token1","type":"address"}],"name":"initialize","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},{"constant":true,"inputs":[],"name":"kLast","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":false,"inputs":[{"internalType":"address","name":"to","type":"address"}],"name":"mint","outputs":[{"internalType":"uint256","name":"liquidity","type":"uint256"}],"payable":false,"stateMutability":"nonpayable","type":"function"},{"constant":true,"inputs":[],"name":"name","outputs":[{"internalType":"string","name":"","type":"string"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[{"internalType":"address","name":"","type":"address"}],"name":"nonces","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":false,"inputs":[{"internalType":"address","name":"owner","type":"address"},{"internalType":"address","name":"spender","type":"address"},{"internalType":"uint256","name":"value","type":"uint256"},{"internalType":"uint256","name":"deadline","type":"uint256"},{"internalType":"uint8","name":"v","type":"uint8"},{"internalType":"bytes32","name":"r","type":"bytes32"},{"internalType":"bytes32","name":"s","type":"bytes32"}],"name":"permit","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},{"constant":true,"inputs":[],"name":"price0CumulativeLast","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"price1CumulativeLast","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":false,"inputs":[{"internalType":"address","name":"to","type":"address"}],"name":"skim","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},{"constant":false,"inputs":[{"internalType":"uint256","name":"amount0Out","type":"uint256"},{"internalType":"uint256","name":"amount1Out","type":"uint256"},{"internalType":"address","name":"to","type":"address"},{"internalType":"bytes","name":"data","type":"bytes"}],"name":"swap","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},{"constant":true,"inputs":[],"name":"symbol","outputs":[{"internalType":"string","name":"","type":"string"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":false,"inputs":[],"name":"sync","outputs":[],"payable":false,"stateMutability":"nonpayable","type":"function"},{"constant":true,"inputs":[],"name":"token0","outputs":[{"internalType":"address","name":"","type":"address"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"token1","outputs":[{"internalType":"address","name":"","type":"address"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"totalSupply","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":false,"inputs":[{"internalType":"address","name":"to","type":"address"},{"internalType":"uint256","name":"value","type":"uint256"}],"name":"transfer","outputs":[{"internalType":"bool","name":"","type":"bool"}],"payable":false,"stateMutability":"nonpayable","type":"function"},{"constant":false,"inputs":[{"internalType":"address","name":"from","type":"address"},{"internalType":"address","name":"to","type":"address"},{"internalType":"uint256","name":"value","type":"uint256"}],"name":"transferFrom","outputs":[{"internalType":"bool","name":"","type":"bool"}],"payable":false,"stateMutability":"nonpayable","type":"function"}]`
+
+// the ABI for Uniswap V3-style concentrated liquidity pools (only the parts used by the listener)
+const v3_abi = `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"sender","type":"address"},{"indexed":true,"internalType":"address","name":"recipient","type":"address"},{"indexed":false,"internalType":"int256","name":"amount0","type":"int256"},{"indexed":false,"internalType":"int256","name":"amount1","type":"int256"},{"indexed":false,"internalType":"uint160","name":"sqrtPriceX96","type":"uint160"},{"indexed":false,"internalType":"uint128","name":"liquidity","type":"uint128"},{"indexed":false,"internalType":"int24","name":"tick","type":"int24"}],"name":"Swap","type":"event"},{"anonymous":false,"inputs":[{"indexed":false,"internalType":"address","name":"sender","type":"address"},{"indexed":true,"internalType":"address","name":"owner","type":"address"},{"indexed":true,"internalType":"int24","name":"tickLower","type":"int24"},{"indexed":true,"internalType":"int24","name":"tickUpper","type":"int24"},{"indexed":false,"internalType":"uint128","name":"amount","type":"uint128"},{"indexed":false,"internalType":"uint256","name":"amount0","type":"uint256"},{"indexed":false,"internalType":"uint256","name":"amount1","type":"uint256"}],"name":"Mint","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"owner","type":"address"},{"indexed":true,"internalType":"int24","name":"tickLower","type":"int24"},{"indexed":true,"internalType":"int24","name":"tickUpper","type":"int24"},{"indexed":false,"internalType":"uint128","name":"amount","type":"uint128"},{"indexed":false,"internalType":"uint256","name":"amount0","type":"uint256"},{"indexed":false,"internalType":"uint256","name":"amount1","type":"uint256"}],"name":"Burn","type":"event"},{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"owner","type":"address"},{"indexed":false,"internalType":"address","name":"recipient","type":"address"},{"indexed":true,"internalType":"int24","name":"tickLower","type":"int24"},{"indexed":true,"internalType":"int24","name":"tickUpper","type":"int24"},{"indexed":false,"internalType":"uint128","name":"amount0","type":"uint128"},{"indexed":false,"internalType":"uint128","name":"amount1","type":"uint128"}],"name":"Collect","type":"event"},{"inputs":[],"name":"slot0","outputs":[{"internalType":"uint160","name":"sqrtPriceX96","type":"uint160"},{"internalType":"int24","name":"tick","type":"int24"},{"internalType":"uint16","name":"observationIndex","type":"uint16"},{"internalType":"uint16","name":"observationCardinality","type":"uint16"},{"internalType":"uint16","name":"observationCardinalityNext","type":"uint16"},{"internalType":"uint8","name":"feeProtocol","type":"uint8"},{"internalType":"bool","name":"unlocked","type":"bool"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"fee","outputs":[{"internalType":"uint24","name":"","type":"uint24"}],"stateMutability":"view","type":"function"},{"inputs":[],"name":"liquidity","outputs":[{"internalType":"uint128","name":"","type":"uint128"}],"stateMutability":"view","type":"function"}]`
+
+// the ABI for Curve/StableSwap pool events. liquidity events take one amount per coin, so they are
+// repeated for pools of 2, 3 and 4 coins (the ABI keeps their raw name, e.g. AddLiquidity0 is still "AddLiquidity").
+func curve_abi() string {
+	events := []string{
+		`{"anonymous":false,"inputs":[{"indexed":true,"name":"buyer","type":"address"},{"indexed":false,"name":"sold_id","type":"int128"},{"indexed":false,"name":"tokens_sold","type":"uint256"},{"indexed":false,"name":"bought_id","type":"int128"},{"indexed":false,"name":"tokens_bought","type":"uint256"}],"name":"TokenExchange","type":"event"}`,
+		`{"anonymous":false,"inputs":[{"indexed":true,"name":"buyer","type":"address"},{"indexed":false,"name":"sold_id","type":"int128"},{"indexed":false,"name":"tokens_sold","type":"uint256"},{"indexed":false,"name":"bought_id","type":"int128"},{"indexed":false,"name":"tokens_bought","type":"uint256"}],"name":"TokenExchangeUnderlying","type":"event"}`,
+		`{"anonymous":false,"inputs":[{"indexed":true,"name":"provider","type":"address"},{"indexed":false,"name":"token_amount","type":"uint256"},{"indexed":false,"name":"coin_amount","type":"uint256"}],"name":"RemoveLiquidityOne","type":"event"}`,
+		`{"anonymous":false,"inputs":[{"indexed":true,"name":"provider","type":"address"},{"indexed":false,"name":"token_amount","type":"uint256"},{"indexed":false,"name":"coin_amount","type":"uint256"},{"indexed":false,"name":"token_supply","type":"uint256"}],"name":"RemoveLiquidityOne","type":"event"}`,
+	}
+	for n := 2; n <= 4; n++ {
+		events = append(events,
+			fmt.Sprintf(`{"anonymous":false,"inputs":[{"indexed":true,"name":"provider","type":"address"},{"indexed":false,"name":"token_amounts","type":"uint256[%[1]d]"},{"indexed":false,"name":"fees","type":"uint256[%[1]d]"},{"indexed":false,"name":"invariant","type":"uint256"},{"indexed":false,"name":"token_supply","type":"uint256"}],"name":"AddLiquidity","type":"event"}`, n),
+			fmt.Sprintf(`{"anonymous":false,"inputs":[{"indexed":true,"name":"provider","type":"address"},{"indexed":false,"name":"token_amounts","type":"uint256[%[1]d]"},{"indexed":false,"name":"fees","type":"uint256[%[1]d]"},{"indexed":false,"name":"token_supply","type":"uint256"}],"name":"RemoveLiquidity","type":"event"}`, n),
+			fmt.Sprintf(`{"anonymous":false,"inputs":[{"indexed":true,"name":"provider","type":"address"},{"indexed":false,"name":"token_amounts","type":"uint256[%[1]d]"},{"indexed":false,"name":"fees","type":"uint256[%[1]d]"},{"indexed":false,"name":"invariant","type":"uint256"},{"indexed":false,"name":"token_supply","type":"uint256"}],"name":"RemoveLiquidityImbalance","type":"event"}`, n),
+		)
+	}
+	return "[" + strings.Join(events, ",") + "]"
+}
+
+// the ABI for the Balancer V2 vault (only the parts used by the listener)
+const vault_abi = `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"bytes32","name":"poolId","type":"bytes32"},{"indexed":true,"internalType":"contract IERC20","name":"tokenIn","type":"address"},{"indexed":true,"internalType":"contract IERC20","name":"tokenOut","type":"address"},{"indexed":false,"internalType":"uint256","name":"amountIn","type":"uint256"},{"indexed":false,"internalType":"uint256","name":"amountOut","type":"uint256"}],"name":"Swap","type":"event"},{"inputs":[{"internalType":"bytes32","name":"poolId","type":"bytes32"}],"name":"getPoolTokens","outputs":[{"internalType":"contract IERC20[]","name":"tokens","type":"address[]"},{"internalType":"uint256[]","name":"balances","type":"uint256[]"},{"internalType":"uint256","name":"lastChangeBlock","type":"uint256"}],"stateMutability":"view","type":"function"}]`
+
+// the ABI for uniswap v2-style factories (only the parts used by the listener)
+const factory_abi = `[{"anonymous":false,"inputs":[{"indexed":true,"internalType":"address","name":"token0","type":"address"},{"indexed":true,"internalType":"address","name":"token1","type":"address"},{"indexed":false,"internalType":"address","name":"pair","type":"address"},{"indexed":false,"internalType":"uint256","name":"","type":"uint256"}],"name":"PairCreated","type":"event"},{"constant":true,"inputs":[{"internalType":"uint256","name":"","type":"uint256"}],"name":"allPairs","outputs":[{"internalType":"address","name":"","type":"address"}],"payable":false,"stateMutability":"view","type":"function"},{"constant":true,"inputs":[],"name":"allPairsLength","outputs":[{"internalType":"uint256","name":"","type":"uint256"}],"payable":false,"stateMutability":"view","type":"function"}]`
+
+// the ABI for Multicall3 (only aggregate3)
+const multicall_abi = `[{"inputs":[{"components":[{"internalType":"address","name":"target","type":"address"},{"internalType":"bool","name":"allowFailure","type":"bool"},{"internalType":"bytes","name":"callData","type":"bytes"}],"internalType":"struct Multicall3.Call3[]","name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"internalType":"bool","name":"success","type":"bool"},{"internalType":"bytes","name":"returnData","type":"bytes"}],"internalType":"struct Multicall3.Result[]","name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}]`
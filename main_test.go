@@ -0,0 +1,37 @@
+package main
+
+import (
+	"math/big"
+	"testing"
+)
+
+// every shape of a v2 Swap payload: amount0In amount1In amount0Out amount1Out
+func TestSwapUpdate(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload [4]int64
+		amt0    int64
+		amt1    int64
+		mode    byte
+	}{
+		{"buy", [4]int64{100, 0, 0, 50}, 100, 50, 0},
+		{"sell", [4]int64{0, 80, 40, 0}, 40, 80, 1},
+		{"both ins", [4]int64{100, 10, 0, 50}, 100, 40, 0},
+		{"both outs", [4]int64{0, 80, 40, 5}, 40, 75, 1},
+		{"flash repaid with a fee", [4]int64{1003, 0, 1000, 0}, 3, 0, 4},
+		{"all zero", [4]int64{0, 0, 0, 0}, 0, 0, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var f []interface{}
+			for _, amt := range tt.payload {
+				f = append(f, big.NewInt(amt))
+			}
+			var p Pair
+			p.swapUpdate(f)
+			if p.amt0.Cmp(big.NewInt(tt.amt0)) != 0 || p.amt1.Cmp(big.NewInt(tt.amt1)) != 0 || p.mode != tt.mode {
+				t.Errorf("got amt0 %s amt1 %s mode %d, want amt0 %d amt1 %d mode %d", p.amt0, p.amt1, p.mode, tt.amt0, tt.amt1, tt.mode)
+			}
+		})
+	}
+}